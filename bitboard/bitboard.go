@@ -391,6 +391,34 @@ func (b Board) LegalMoves() []string {
 	return legalMoves
 }
 
+// KingTakesRook maps castling written as the king capturing its own rook, as Polyglot books and Lichess cloud
+// evals do, to the UCI move.
+var KingTakesRook = map[string]string{
+	"e1h1": "e1g1",
+	"e1a1": "e1c1",
+	"e8h8": "e8g8",
+	"e8a8": "e8c8",
+}
+
+// NormalizeCastling returns the UCI castling move for a king-takes-rook move, if that's the legal move.
+// Any other move is returned unchanged.
+func (b Board) NormalizeCastling(uci string) string {
+	castle, ok := KingTakesRook[uci]
+	if !ok {
+		return uci
+	}
+
+	var isLegal, castleIsLegal bool
+	for _, move := range b.LegalMoves() {
+		isLegal = isLegal || move == uci
+		castleIsLegal = castleIsLegal || move == castle
+	}
+	if !isLegal && castleIsLegal {
+		return castle
+	}
+	return uci
+}
+
 func (b Board) String() string {
 	/*
 	   +---+---+---+---+---+---+---+---+
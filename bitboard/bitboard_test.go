@@ -944,3 +944,36 @@ func TestBoard_LegalMoves(t *testing.T) {
 		})
 	}
 }
+
+func TestBoard_NormalizeCastling(t *testing.T) {
+	cases := []struct {
+		name string
+		fen  string
+		uci  string
+		want string
+	}{
+		{name: "white king side", fen: "r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", uci: "e1h1", want: "e1g1"},
+		{name: "black queen side", fen: "r3k2r/8/8/8/8/8/8/R3K2R b KQkq - 0 1", uci: "e8a8", want: "e8c8"},
+		{name: "already uci", fen: "r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", uci: "e1g1", want: "e1g1"},
+		{name: "no castling rights", fen: "r3k2r/8/8/8/8/8/8/R3K2R w - - 0 1", uci: "e1h1", want: "e1h1"},
+		{name: "not a castling move", fen: "startpos", uci: "e2e4", want: "e2e4"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// arrange
+			b, err := ParseFEN(c.fen)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// act
+			got := b.NormalizeCastling(c.uci)
+
+			// assert
+			if c.want != got {
+				t.Errorf("want: %s got: %s", c.want, got)
+			}
+		})
+	}
+}
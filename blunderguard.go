@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+)
+
+// blunderGuard removes the candidates of a move source whose evaluation is more than threshold
+// centipawns worse than the best evaluated move. Candidates without an evaluation are kept. If every
+// candidate is vetoed, the least bad one is kept, so the source still plays its own move rather than
+// handing over to a random one.
+type blunderGuard struct {
+	source    MoveSource
+	threshold int
+	// evals waits, until ctx is done, for the evaluations of the position
+	evals func(ctx context.Context) moveEvaluations
+
+	mtx    sync.Mutex
+	vetoed []string
+}
+
+func (g *blunderGuard) Candidates(ctx context.Context) ([]Candidate, error) {
+	candidates, err := g.source.Candidates(ctx)
+	if err != nil || len(candidates) == 0 {
+		return candidates, err
+	}
+
+	kept, vetoed := vetoBlunders(candidates, g.evals(ctx), g.threshold)
+
+	g.mtx.Lock()
+	g.vetoed = append(g.vetoed, vetoed...)
+	g.mtx.Unlock()
+
+	return kept, nil
+}
+
+// String lists the vetoed moves and their centipawn loss, e.g. "f2f3 (-312) g2g4 (no eval)".
+func (g *blunderGuard) String() string {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	return strings.Join(g.vetoed, " ")
+}
+
+func vetoBlunders(candidates []Candidate, evals moveEvaluations, threshold int) ([]Candidate, []string) {
+	best := math.MinInt
+	for uci := range evals {
+		if ev, ok := evals.best(uci); ok && ev.cp() > best {
+			best = ev.cp()
+		}
+	}
+
+	var (
+		kept   []Candidate
+		vetoed []string
+
+		leastBad   = -1
+		leastBadCP = math.MinInt
+	)
+	for i, candidate := range candidates {
+		ev, ok := evals.best(candidate.UCI)
+		if ok && best-ev.cp() > threshold {
+			vetoed = append(vetoed, fmt.Sprintf("%s (%d)", candidate.UCI, ev.cp()-best))
+			if ev.cp() > leastBadCP {
+				leastBad, leastBadCP = i, ev.cp()
+			}
+			continue
+		}
+		kept = append(kept, candidate)
+	}
+
+	if len(kept) == 0 && leastBad != -1 {
+		kept = append(kept, candidates[leastBad])
+		vetoed = append(vetoed[:leastBad], vetoed[leastBad+1:]...)
+	}
+
+	return kept, vetoed
+}
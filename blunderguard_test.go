@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"automock/bitboard"
+	"automock/config"
+	"automock/httpcache"
+	"automock/lichess"
+	"automock/store"
+)
+
+func TestVetoBlunders(t *testing.T) {
+	candidates := []Candidate{
+		{UCI: "e2e4", Weight: 10, Source: "lichess"},
+		{UCI: "f2f3", Weight: 5, Source: "lichess"},
+		{UCI: "g2g4", Weight: 1, Source: "lichess"},
+	}
+
+	cases := []struct {
+		name       string
+		evals      moveEvaluations
+		threshold  int
+		wantUCI    []string
+		wantVetoed []string
+	}{
+		{
+			name:    "no evaluations",
+			evals:   moveEvaluations{},
+			wantUCI: []string{"e2e4", "f2f3", "g2g4"},
+		},
+		{
+			name: "within threshold",
+			evals: moveEvaluations{
+				"e2e4": {{CP: 30}},
+				"f2f3": {{CP: -60}},
+			},
+			threshold: 100,
+			wantUCI:   []string{"e2e4", "f2f3", "g2g4"},
+		},
+		{
+			name: "unevaluated candidates are kept",
+			evals: moveEvaluations{
+				"d2d4": {{CP: 35}},
+				"e2e4": {{CP: -200}},
+			},
+			threshold:  100,
+			wantUCI:    []string{"f2f3", "g2g4"},
+			wantVetoed: []string{"e2e4 (-235)"},
+		},
+		{
+			name: "every candidate vetoed keeps the least bad",
+			evals: moveEvaluations{
+				"d2d4": {{CP: 40}},
+				"e2e4": {{CP: -200}},
+				"f2f3": {{CP: -90}},
+				"g2g4": {{Mate: -2}},
+			},
+			threshold:  50,
+			wantUCI:    []string{"f2f3"},
+			wantVetoed: []string{"e2e4 (-240)", "g2g4 (-30036)"},
+		},
+		{
+			name: "worse than the best move",
+			evals: moveEvaluations{
+				"d2d4": {{CP: 40}},
+				"e2e4": {{CP: 30}},
+				"f2f3": {{CP: -60}},
+				"g2g4": {{Mate: -2}},
+			},
+			threshold:  50,
+			wantUCI:    []string{"e2e4"},
+			wantVetoed: []string{"f2f3 (-100)", "g2g4 (-30036)"},
+		},
+		{
+			name: "deepest evaluation decides",
+			evals: moveEvaluations{
+				"e2e4": {{CP: 30, Depth: 20}},
+				"f2f3": {{CP: -300, Depth: 10}, {CP: 20, Depth: 30}},
+			},
+			threshold: 50,
+			wantUCI:   []string{"e2e4", "f2f3", "g2g4"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// act
+			kept, vetoed := vetoBlunders(candidates, c.evals, c.threshold)
+
+			// assert
+			var gotUCI []string
+			for _, candidate := range kept {
+				gotUCI = append(gotUCI, candidate.UCI)
+			}
+			if !reflect.DeepEqual(c.wantUCI, gotUCI) {
+				t.Errorf("kept want: %v got: %v", c.wantUCI, gotUCI)
+			}
+			if !reflect.DeepEqual(c.wantVetoed, vetoed) {
+				t.Errorf("vetoed want: %v got: %v", c.wantVetoed, vetoed)
+			}
+		})
+	}
+}
+
+func TestSearch_BlunderGuardWaitsForEngine(t *testing.T) {
+	// arrange
+	t.Setenv(testProcessEnv, "engine")
+	t.Setenv(fakeEngineInfoEnv, "info depth 20 multipv 1 score cp 30 pv e2e4|info depth 20 multipv 2 score cp -150 pv f2f3|info depth 20 multipv 3 score cp -400 pv g2g4")
+
+	e := NewEngine(config.Config{ExternalEngine: config.ExternalEngine{Path: os.Args[0]}})
+	if e.extEngine == nil {
+		t.Fatal("external engine didn't start")
+	}
+	defer e.extEngine.Terminate()
+
+	for option, value := range map[string]string{
+		"Move_Sources":           "explorer>random",
+		"Blunder_Threshold_CP":   "100",
+		"ExternalEngine_MultiPV": "3",
+	} {
+		uciOption, _ := e.findUCIOption(option)
+		if err := uciOption.Set(e, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// only the engine evaluates the position: the cloud eval and chessdb aren't cached
+	httpcache.SetCacheDir(t.TempDir())
+	httpcache.SetOffline(true)
+	defer httpcache.SetOffline(false)
+
+	s, err := store.Open(filepath.Join(t.TempDir(), "store.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	lichess.SetStore(s, time.Hour)
+	defer lichess.SetStore(nil, 0)
+
+	bb := bitboard.StartPosBoard()
+	settings := e.searchSettings(bitboard.StartPos, nil, bb.ActiveColor)
+	putResponse(t, s, settings.request.StoreKey(), lichess.OpeningExplorerResponse{
+		Moves: []lichess.OpeningExplorerMove{
+			{UCI: "f2f3", White: 10, Draws: 10, Black: 10},
+			{UCI: "g2g4", White: 10, Draws: 10, Black: 10},
+		},
+	})
+
+	// act
+	msg := e.search(context.Background(), nil, time.Now(), GoArgs{MoveTime: 3000}, settings, bitboard.StartPos, nil, bb)
+
+	// assert
+	if !strings.Contains(msg, "vetoed g2g4 (-430)\n") {
+		t.Errorf("want g2g4 vetoed, got:\n%s", msg)
+	}
+	// both explorer moves lose too much, so the least bad is played rather than a random move
+	if !strings.HasSuffix(msg, "bestmove f2f3\n") {
+		t.Errorf("want bestmove f2f3, got:\n%s", msg)
+	}
+}
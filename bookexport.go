@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"golang.org/x/xerrors"
+
+	"automock/bitboard"
+	"automock/config"
+	"automock/lichess"
+	"automock/polyglot"
+	"automock/utils"
+)
+
+type bookExportCmd struct {
+	Output   string `arg:"" help:"Polyglot book to write." type:"path"`
+	FEN      string `help:"Root position." default:"startpos"`
+	Depth    int    `help:"Number of plies to export." default:"12"`
+	MinGames int    `help:"Minimum number of games for a move to be included." default:"100"`
+
+	// the filters are applied through the engine options, so they take the same values as setoption
+	Speeds    string `help:"Lichess_Speeds, e.g. blitz,rapid. Defaults to the engine default."`
+	RatingMin string `help:"Lichess_Rating_Min. Defaults to the engine default."`
+	RatingMax string `help:"Lichess_Rating_Max. Defaults to the engine default."`
+	Since     string `help:"Lichess_Since, YYYY-MM. Defaults to the engine default."`
+	Until     string `help:"Lichess_Until, YYYY-MM. Defaults to the engine default."`
+}
+
+func (c bookExportCmd) Run(cfg config.Config) error {
+	if c.Depth < 1 {
+		return xerrors.Errorf("depth must be at least 1")
+	}
+
+	if s := openStore(cfg); s != nil {
+		defer s.Close()
+	}
+
+	// the export doesn't search, so don't start the external engine
+	cfg.ExternalEngine.Path = ""
+	e := NewEngine(cfg)
+
+	options := []struct {
+		name  string
+		value string
+	}{
+		{name: "Lichess_Speeds", value: c.Speeds},
+		{name: "Lichess_Rating_Min", value: c.RatingMin},
+		{name: "Lichess_Rating_Max", value: c.RatingMax},
+		{name: "Lichess_Since", value: c.Since},
+		{name: "Lichess_Until", value: c.Until},
+	}
+
+	for _, option := range options {
+		if option.value == "" {
+			continue
+		}
+		uciOption, _ := e.findUCIOption(option.name)
+		if err := uciOption.Set(e, option.value); err != nil {
+			return xerrors.Errorf("option %s rejected: %w", option.name, err)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	exporter := bookExporter{
+		fetch:    lichess.GetLichessGames,
+		request:  e.lichessRequest,
+		Depth:    c.Depth,
+		MinGames: c.MinGames,
+		Progress: func(fetched, queued int) {
+			fmt.Fprintf(os.Stderr, "\rpositions fetched: %d queued: %d", fetched, queued)
+		},
+	}
+
+	w := polyglot.NewWriter()
+	err := exporter.Export(ctx, c.FEN, w)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return xerrors.Errorf("%w", err)
+	}
+
+	f, err := os.Create(c.Output)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := w.WriteTo(f); err != nil {
+		return xerrors.Errorf("%w", err)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	msg := fmt.Sprintf("book export: wrote %d entries for %d positions to '%s'", w.Len(), w.Positions(), c.Output)
+	utils.Log(msg)
+	fmt.Fprintln(os.Stderr, msg)
+
+	return nil
+}
+
+// bookExporter walks the opening explorer tree from a root position and collects the moves into a
+// Polyglot book, weighted by the number of games each move was played in. The walk is also used by
+// "prefetch" to fill the cache.
+type bookExporter struct {
+	// fetch is lichess.GetLichessGames for the export and the Lichess_Database lookup for prefetch
+	fetch   func(ctx context.Context, req lichess.OpeningExplorerRequest) (lichess.OpeningExplorerResponse, error)
+	request func(fen string, moves []string) lichess.OpeningExplorerRequest
+
+	// Depth is the number of plies to walk below the root.
+	Depth int
+	// MinGames is the number of games a move needs to be added to the book and explored further.
+	MinGames int
+	// Progress, if set, is called after each position is fetched.
+	Progress func(fetched, queued int)
+}
+
+type bookExportNode struct {
+	board bitboard.Board
+	moves []string
+	ply   int
+}
+
+// Export walks the tree and adds each position's moves to w.
+func (x bookExporter) Export(ctx context.Context, startFEN string, w *polyglot.Writer) error {
+	return x.Walk(ctx, startFEN, func(b bitboard.Board, moves []string, explorerMoves []lichess.OpeningExplorerMove) error {
+		bookMoves := make([]polyglot.Move, len(explorerMoves))
+		for i, move := range explorerMoves {
+			bookMoves[i] = polyglot.Move{UCI: move.UCI, Weight: move.Total()}
+		}
+		return w.Add(b, bookMoves)
+	})
+}
+
+// Walk calls visit for each position in the tree, with the moves from it that were played in at least
+// MinGames games. moves are the moves played from startFEN to reach the position. The tree is walked
+// breadth first so a transposition is explored from the shallowest ply it's reached at.
+func (x bookExporter) Walk(ctx context.Context, startFEN string, visit func(b bitboard.Board, moves []string, explorerMoves []lichess.OpeningExplorerMove) error) error {
+	root, err := bitboard.ParseFEN(startFEN)
+	if err != nil {
+		return xerrors.Errorf("%w", err)
+	}
+
+	visited := map[uint64]struct{}{polyglot.Key(root): {}}
+	queue := []bookExportNode{{board: root}}
+
+	var fetched int
+
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+
+		resp, err := x.fetch(ctx, x.request(startFEN, node.moves))
+		if err != nil {
+			return xerrors.Errorf("position after '%v': %w", node.moves, err)
+		}
+		fetched++
+
+		var explorerMoves []lichess.OpeningExplorerMove
+		for _, move := range resp.Moves {
+			total := move.Total()
+			if total == 0 || total < x.MinGames {
+				continue
+			}
+
+			explorerMoves = append(explorerMoves, move)
+
+			if node.ply+1 >= x.Depth {
+				continue
+			}
+
+			next, err := node.board.Apply(move.UCI)
+			if err != nil {
+				return xerrors.Errorf("position after '%v': %w", node.moves, err)
+			}
+
+			key := polyglot.Key(next)
+			if _, ok := visited[key]; ok {
+				continue
+			}
+			visited[key] = struct{}{}
+
+			moves := make([]string, len(node.moves), len(node.moves)+1)
+			copy(moves, node.moves)
+			queue = append(queue, bookExportNode{board: next, moves: append(moves, move.UCI), ply: node.ply + 1})
+		}
+
+		if err := visit(node.board, node.moves, explorerMoves); err != nil {
+			return xerrors.Errorf("position after '%v': %w", node.moves, err)
+		}
+
+		if x.Progress != nil {
+			x.Progress(fetched, len(queue))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+
+	"automock/bitboard"
+	"automock/config"
+	"automock/lichess"
+	"automock/polyglot"
+)
+
+func TestBookExporter_Export(t *testing.T) {
+	// keyed by the moves played from the start position
+	tree := map[string][]lichess.OpeningExplorerMove{
+		"": {
+			{UCI: "e2e4", White: 500, Draws: 100, Black: 400},
+			{UCI: "d2d4", White: 400, Draws: 100, Black: 300},
+			{UCI: "b2b4", White: 5, Draws: 0, Black: 5},
+		},
+		"e2e4":           {{UCI: "c7c5", White: 300, Black: 200}, {UCI: "e7e5", White: 200, Black: 200}},
+		"d2d4":           {{UCI: "g8f6", White: 200, Black: 200}},
+		"e2e4,c7c5":      {{UCI: "g1f3", White: 150, Black: 150}},
+		"e2e4,e7e5":      {{UCI: "g1f3", White: 150, Black: 150}},
+		"d2d4,g8f6":      {{UCI: "c2c4", White: 150, Black: 150}},
+		"e2e4,c7c5,g1f3": {{UCI: "d7d6", White: 100, Black: 100}},
+	}
+
+	cases := []struct {
+		name      string
+		depth     int
+		minGames  int
+		positions int
+		fetched   []string
+	}{
+		{name: "depth 1", depth: 1, minGames: 100, positions: 1, fetched: []string{""}},
+		{name: "depth 2", depth: 2, minGames: 100, positions: 3, fetched: []string{"", "e2e4", "d2d4"}},
+		{name: "min games", depth: 3, minGames: 500, positions: 2, fetched: []string{"", "e2e4", "d2d4", "e2e4,c7c5"}},
+		{name: "min games 0 includes every move", depth: 2, minGames: 0, positions: 3, fetched: []string{"", "e2e4", "d2d4", "b2b4"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// arrange
+			var fetched []string
+			x := bookExporter{
+				fetch: func(ctx context.Context, req lichess.OpeningExplorerRequest) (lichess.OpeningExplorerResponse, error) {
+					fetched = append(fetched, req.Play)
+					return lichess.OpeningExplorerResponse{Moves: tree[req.Play]}, nil
+				},
+				request:  NewEngine(config.Config{}).lichessRequest,
+				Depth:    c.depth,
+				MinGames: c.minGames,
+			}
+			w := polyglot.NewWriter()
+
+			// act
+			err := x.Export(context.Background(), "startpos", w)
+
+			// assert
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprint(c.fetched) != fmt.Sprint(fetched) {
+				t.Errorf("fetched want: %q got: %q", c.fetched, fetched)
+			}
+			if c.positions != w.Positions() {
+				t.Errorf("positions want: %d got: %d", c.positions, w.Positions())
+			}
+		})
+	}
+}
+
+func TestBookExporter_Export_Weights(t *testing.T) {
+	// arrange
+	x := bookExporter{
+		fetch: func(ctx context.Context, req lichess.OpeningExplorerRequest) (lichess.OpeningExplorerResponse, error) {
+			return selectionTestResponse, nil
+		},
+		request: NewEngine(config.Config{}).lichessRequest,
+		Depth:   1,
+	}
+	w := polyglot.NewWriter()
+
+	fen := "rnbqkbnr/pp1ppppp/8/2p5/4P3/5N2/PPPP1PPP/RNBQKB1R b KQkq - 1 2"
+
+	// act
+	if err := x.Export(context.Background(), fen, w); err != nil {
+		t.Fatal(err)
+	}
+
+	// assert
+	var buf bytes.Buffer
+	if _, err := w.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	book, err := polyglot.Read(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := bitboard.ParseFEN(fen)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []polyglot.Move{{UCI: "d7d6", Weight: 1000}, {UCI: "b8c6", Weight: 600}, {UCI: "e7e6", Weight: 400}, {UCI: "g7g6", Weight: 100}}
+	if got := book.Lookup(b); fmt.Sprint(want) != fmt.Sprint(got) {
+		t.Errorf("want: %v got: %v", want, got)
+	}
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"automock/bitboard"
+	"automock/chessdb"
+	"automock/commas"
+	"automock/config"
+	"automock/httpcache"
+	"automock/lichess"
+	"automock/utils"
+)
+
+type cacheMigrateCmd struct {
+	Dir string `help:"Cache directory to migrate. Defaults to the cache_dir in the config file." type:"path"`
+}
+
+func (c cacheMigrateCmd) Run(cfg config.Config) error {
+	dir := c.Dir
+	if dir == "" {
+		dir = cfg.CacheDir
+	}
+
+	result, err := httpcache.Migrate(dir)
+	if err != nil {
+		return xerrors.Errorf("%w", err)
+	}
+
+	msg := fmt.Sprintf("cache migrate: %s: migrated %d entries, skipped %d", dir, result.Migrated, result.Skipped)
+	utils.Log(msg)
+	fmt.Fprintln(os.Stderr, msg)
+
+	return nil
+}
+
+type cacheStatsCmd struct{}
+
+func (c cacheStatsCmd) Run(cfg config.Config) error {
+	type stats struct {
+		entries int
+		size    int64
+	}
+
+	var total stats
+	hosts := make(map[string]*stats)
+	sources := make(map[string]*stats)
+
+	add := func(m map[string]*stats, name string, size int64) {
+		s, ok := m[name]
+		if !ok {
+			s = &stats{}
+			m[name] = s
+		}
+		s.entries++
+		s.size += size
+	}
+
+	err := httpcache.Entries(cfg.CacheDir, func(entry httpcache.Entry) error {
+		add(hosts, entry.Host(), entry.Size)
+		add(sources, entry.Source(), entry.Size)
+		total.entries++
+		total.size += entry.Size
+		return nil
+	})
+	if err != nil {
+		return xerrors.Errorf("%w", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+	sections := []struct {
+		title string
+		stats map[string]*stats
+	}{
+		{title: "HOST", stats: hosts},
+		{title: "SOURCE", stats: sources},
+	}
+	for _, section := range sections {
+		names := make([]string, 0, len(section.stats))
+		for name := range section.stats {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		fmt.Fprintf(w, "%s\tENTRIES\tBYTES\n", section.title)
+		for _, name := range names {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", name, commas.Int(section.stats[name].entries), commas.Int(int(section.stats[name].size)))
+		}
+		fmt.Fprintln(w, "\t\t")
+	}
+	fmt.Fprintf(w, "TOTAL\t%s\t%s\n", commas.Int(total.entries), commas.Int(int(total.size)))
+
+	return w.Flush()
+}
+
+type cacheLsCmd struct {
+	Source string `help:"Only list entries whose source starts with this, e.g. explorer.lichess.ovh/masters."`
+	FEN    string `help:"Only list entries for this position."`
+}
+
+func (c cacheLsCmd) Run(cfg config.Config) error {
+	var fenKey string
+	if c.FEN != "" {
+		b, err := bitboard.ParseFEN(c.FEN)
+		if err != nil {
+			return xerrors.Errorf("%w", err)
+		}
+		fenKey = b.FENKey()
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "FETCHED\tBYTES\tSOURCE\tFEN\tQUERY")
+
+	err := httpcache.Entries(cfg.CacheDir, func(entry httpcache.Entry) error {
+		if !strings.HasPrefix(entry.Source(), c.Source) {
+			return nil
+		}
+		position, _ := entryPosition(entry)
+		if fenKey != "" && position != fenKey {
+			return nil
+		}
+
+		_, err := fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\n",
+			entry.FetchedAt.Format(time.RFC3339), entry.Size, entry.Source(), position, entry.Query.Encode())
+		return err
+	})
+	if err != nil {
+		return xerrors.Errorf("%w", err)
+	}
+
+	return w.Flush()
+}
+
+type cacheShowCmd struct {
+	FEN string `arg:"" help:"Position to show, as a FEN or startpos."`
+}
+
+func (c cacheShowCmd) Run(cfg config.Config) error {
+	b, err := bitboard.ParseFEN(c.FEN)
+	if err != nil {
+		return xerrors.Errorf("%w", err)
+	}
+	fenKey := b.FENKey()
+
+	var entries []httpcache.Entry
+	err = httpcache.Entries(cfg.CacheDir, func(entry httpcache.Entry) error {
+		if position, ok := entryPosition(entry); ok && position == fenKey {
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+	if err != nil {
+		return xerrors.Errorf("%w", err)
+	}
+
+	if len(entries) == 0 {
+		return xerrors.Errorf("no cached responses for '%s'", fenKey)
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Source() < entries[j].Source() })
+
+	for _, entry := range entries {
+		body, err := httpcache.ReadBody(cfg.CacheDir, entry)
+		if err != nil {
+			return xerrors.Errorf("%w", err)
+		}
+
+		fmt.Printf("%s fetched %s\n  %s\n", entry.Source(), entry.FetchedAt.Format(time.RFC3339), entry.Query.Encode())
+		if err := showPayload(entry, body); err != nil {
+			fmt.Printf("  can't decode: %s\n", err.Error())
+		}
+		fmt.Println()
+	}
+
+	return nil
+}
+
+// entryPosition returns the position a cached request was for, as a FEN key. Explorer requests name a
+// start position and the moves played from it; chessdb calls the FEN "board".
+func entryPosition(entry httpcache.Entry) (string, bool) {
+	fen := entry.Query.Get("fen")
+	if fen == "" {
+		fen = entry.Query.Get("board")
+	}
+	if fen == "" {
+		return "", false
+	}
+
+	b, err := bitboard.ParseFEN(fen)
+	if err != nil {
+		return "", false
+	}
+	if play := entry.Query.Get("play"); play != "" {
+		b, err = b.Apply(strings.Split(play, ",")...)
+		if err != nil {
+			return "", false
+		}
+	}
+
+	return b.FENKey(), true
+}
+
+// showPayload prints a cached body decoded according to the endpoint it came from.
+func showPayload(entry httpcache.Entry, body []byte) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+	switch source := entry.Source(); {
+	case strings.HasPrefix(source, "explorer.lichess.ovh/"):
+		var resp lichess.OpeningExplorerResponse
+		var err error
+		if source == "explorer.lichess.ovh/player" {
+			resp, err = lichess.ParsePlayerGames(body)
+		} else {
+			err = json.Unmarshal(body, &resp)
+		}
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(w, "  games %d white %d draws %d black %d\n", resp.Total(), resp.White, resp.Draws, resp.Black)
+		fmt.Fprintln(w, "  MOVE\tSAN\tGAMES\tWHITE\tDRAWS\tBLACK\tAVG RATING")
+		for _, move := range resp.Moves {
+			fmt.Fprintf(w, "  %s\t%s\t%d\t%d\t%d\t%d\t%d\n", move.UCI, move.SAN, move.Total(), move.White, move.Draws, move.Black, move.AverageRating)
+		}
+	case source == "lichess.org/api/cloud-eval":
+		var resp lichess.CloudEvalResponse
+		if err := json.Unmarshal(body, &resp); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(w, "  depth %d knodes %d\n", resp.Depth, resp.KNodes)
+		fmt.Fprintln(w, "  SCORE\tPV")
+		for _, pv := range resp.PVs {
+			score := fmt.Sprintf("cp %d", pv.CP)
+			if pv.Mate != 0 {
+				score = fmt.Sprintf("mate %d", pv.Mate)
+			}
+			fmt.Fprintf(w, "  %s\t%s\n", score, pv.MovesUCI)
+		}
+	case entry.Query.Get("action") == "queryall":
+		var resp chessdb.QueryAllResponse
+		if err := json.Unmarshal(body, &resp); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(w, "  status %s\n", resp.Status)
+		fmt.Fprintln(w, "  MOVE\tSAN\tSCORE\tRANK\tWINRATE\tNOTE")
+		for _, move := range resp.Moves {
+			fmt.Fprintf(w, "  %s\t%s\t%d\t%d\t%s\t%s\n", move.UCI, move.SAN, move.Score, move.Rank, move.WinRate, move.Note)
+		}
+	default:
+		fmt.Fprintf(w, "  %s\n", body)
+	}
+
+	return w.Flush()
+}
+
+type cachePurgeCmd struct {
+	Source        string `help:"Only delete entries whose source starts with this, e.g. lichess.org/api/cloud-eval."`
+	OlderThanDays int    `help:"Only delete entries fetched more than this many days ago. 0 deletes regardless of age."`
+}
+
+func (c cachePurgeCmd) Run(cfg config.Config) error {
+	var before time.Time
+	if c.OlderThanDays > 0 {
+		before = time.Now().Add(-time.Duration(c.OlderThanDays) * 24 * time.Hour)
+	}
+
+	deleted, err := httpcache.Purge(cfg.CacheDir, c.Source, before)
+	if err != nil {
+		return xerrors.Errorf("%w", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "cache purge: deleted %d entries\n", deleted)
+	return nil
+}
+
+type cacheExportCmd struct {
+	Output string `arg:"" help:"Archive to write, a .tar.gz." type:"path"`
+}
+
+func (c cacheExportCmd) Run(cfg config.Config) error {
+	f, err := os.Create(c.Output)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	n, err := httpcache.Export(cfg.CacheDir, f)
+	if err != nil {
+		return xerrors.Errorf("%w", err)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "cache export: wrote %d entries to '%s'\n", n, c.Output)
+	return nil
+}
+
+type cacheImportCmd struct {
+	Input string `arg:"" help:"Archive written by 'cache export'." type:"existingfile"`
+}
+
+func (c cacheImportCmd) Run(cfg config.Config) error {
+	f, err := os.Open(c.Input)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	result, err := httpcache.Import(cfg.CacheDir, f)
+	if err != nil {
+		return xerrors.Errorf("%w", err)
+	}
+
+	msg := fmt.Sprintf("cache import: %s: imported %d entries, skipped %d", c.Input, result.Imported, result.Skipped)
+	utils.Log(msg)
+	fmt.Fprintln(os.Stderr, msg)
+
+	return nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+
+	"automock/httpcache"
+)
+
+func TestEntryPosition(t *testing.T) {
+	const afterE4 = "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq -"
+
+	cases := []struct {
+		name   string
+		query  url.Values
+		want   string
+		wantOK bool
+	}{
+		{name: "explorer fen", query: url.Values{"fen": {afterE4 + " 0 1"}}, want: afterE4, wantOK: true},
+		{name: "explorer fen and play", query: url.Values{"fen": {"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"}, "play": {"e2e4"}}, want: afterE4, wantOK: true},
+		{name: "chessdb board", query: url.Values{"action": {"queryall"}, "board": {afterE4 + " 0 1"}}, want: afterE4, wantOK: true},
+		{name: "illegal play", query: url.Values{"fen": {afterE4 + " 0 1"}, "play": {"e2e4"}}},
+		{name: "no position", query: url.Values{"player": {"someone"}}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// act
+			got, ok := entryPosition(httpcache.Entry{Query: c.query})
+
+			// assert
+			if c.wantOK != ok || c.want != got {
+				t.Errorf("want: %q, %v got: %q, %v", c.want, c.wantOK, got, ok)
+			}
+		})
+	}
+}
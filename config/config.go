@@ -0,0 +1,130 @@
+// Package config loads AutoMock's configuration file.
+//
+// The file is JSON, for example:
+//
+//	{
+//	    "external_engine": {
+//	        "path": "/usr/local/bin/stockfish",
+//	        "options": [
+//	            {"name": "SyzygyPath", "value": "/tb/syzygy"}
+//	        ]
+//	    },
+//	    "log_file": "/var/log/automock.log",
+//	    "cache_dir": "/var/cache/automock",
+//	    "store_file": "/var/lib/automock/automock.db",
+//	    "store_max_age_days": 30,
+//	    "lichess_api_token": "lip_...",
+//	    "offline": false
+//	}
+//
+// Every field is optional. Without an external engine AutoMock falls back to a random legal move when
+// the explorer has no moves. AUTOMOCK_OFFLINE=1 in the environment starts AutoMock offline whatever the
+// file says.
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"golang.org/x/xerrors"
+)
+
+const (
+	defaultFileName = "automock.json"
+	defaultLogFile  = "./automock.log"
+	defaultCacheDir = "./cache"
+
+	defaultStoreFile       = "./automock.db"
+	defaultStoreMaxAgeDays = 30
+
+	lichessAPITokenEnvName = "LICHESS_API_TOKEN"
+	offlineEnvName         = "AUTOMOCK_OFFLINE"
+)
+
+type Config struct {
+	ExternalEngine  ExternalEngine `json:"external_engine"`
+	LogFile         string         `json:"log_file"`
+	CacheDir        string         `json:"cache_dir"`
+	StoreFile       string         `json:"store_file"`
+	StoreMaxAgeDays int            `json:"store_max_age_days"`
+	LichessAPIToken string         `json:"lichess_api_token"`
+	Offline         bool           `json:"offline"`
+}
+
+type ExternalEngine struct {
+	Path    string   `json:"path"`
+	Options []Option `json:"options"`
+}
+
+// Option is a "setoption" sent to the external engine after it starts.
+type Option struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Load reads the config file at path. If path is empty, ./automock.json is tried, then automock/config.json
+// in the user's config directory; if neither exists the defaults are returned.
+func Load(path string) (Config, error) {
+	var cfg Config
+
+	if path == "" {
+		path = findDefault()
+	}
+
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return Config{}, xerrors.Errorf("config file '%s': %w", path, err)
+		}
+		if err := json.Unmarshal(b, &cfg); err != nil {
+			return Config{}, xerrors.Errorf("config file '%s': %w", path, err)
+		}
+	}
+
+	if cfg.LogFile == "" {
+		cfg.LogFile = defaultLogFile
+	}
+	if cfg.CacheDir == "" {
+		cfg.CacheDir = defaultCacheDir
+	}
+	if cfg.StoreFile == "" {
+		cfg.StoreFile = defaultStoreFile
+	}
+	if cfg.StoreMaxAgeDays == 0 {
+		cfg.StoreMaxAgeDays = defaultStoreMaxAgeDays
+	}
+	if cfg.LichessAPIToken == "" {
+		cfg.LichessAPIToken = os.Getenv(lichessAPITokenEnvName)
+	}
+	if value := os.Getenv(offlineEnvName); value != "" {
+		offline, err := strconv.ParseBool(value)
+		if err != nil {
+			return Config{}, xerrors.Errorf("%s: '%s' is not a boolean", offlineEnvName, value)
+		}
+		cfg.Offline = offline
+	}
+
+	return cfg, nil
+}
+
+func findDefault() string {
+	candidates := []string{defaultFileName}
+	if dir, err := os.UserConfigDir(); err == nil {
+		candidates = append(candidates, filepath.Join(dir, "automock", "config.json"))
+	}
+
+	for _, candidate := range candidates {
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			// let Load report why it can't be read
+			return candidate
+		}
+	}
+
+	return ""
+}
@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"math/rand"
 	"os"
-	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -16,18 +15,39 @@ import (
 
 	"automock/bitboard"
 	"automock/chessdb"
+	"automock/config"
 	"automock/extengine"
+	"automock/httpcache"
 	"automock/lichess"
+	"automock/pgndb"
+	"automock/polyglot"
 	"automock/utils"
 )
 
 const (
-	// TODO: remove hard coded paths
-	berserkPath = "/home/jud/projects/sf/berserk_13"
-
 	bufferedChannelSize = 4096
+
+	stopSearchTimeout = 3000 * time.Millisecond
+	quitTimeout       = 1500 * time.Millisecond
+
+	// nullMove is the bestmove sent when the position has no legal moves
+	nullMove = "0000"
+
+	DatabaseLichess = "lichess"
+	DatabaseMasters = "masters"
+	DatabaseBlend   = "blend"
+	DatabasePGN     = "pgn"
+
+	// blendMastersMinGames is how many masters games a position needs for "blend" to prefer them.
+	blendMastersMinGames = 100
+
+	// cloudEvalMultiPV is the number of lines requested from the cloud eval. prefetch has to ask for the
+	// same number to hit the same cache entry.
+	cloudEvalMultiPV = 3
 )
 
+var validDatabases = []string{DatabaseLichess, DatabaseMasters, DatabaseBlend, DatabasePGN}
+
 type Engine struct {
 	UCIOptions []UCIOption
 
@@ -42,6 +62,52 @@ type Engine struct {
 	LichessSince     lichess.Date
 	LichessUntil     lichess.Date
 
+	LichessDatabase     string
+	LichessMastersSince int
+	LichessMastersUntil int
+
+	MoveSelection            string
+	MoveSelectionTemperature int
+	MoveSelectionTopN        int
+
+	RandomSeed int
+
+	LichessPlayer       string
+	LichessPlayerWeight int
+
+	ExternalEnginePath    string
+	ExternalEngineMultiPV int
+	LogFile               string
+
+	MoveSources  string
+	movePipeline movePipeline
+
+	BookFile string
+	book     *polyglot.Book
+
+	PGNDatabase string
+	pgnDB       *pgndb.Database
+
+	Offline bool
+
+	UCIShowWDL bool
+
+	BlunderThresholdCP int
+	BlunderSkipPercent int
+
+	UCILimitStrength bool
+	UCIElo           int
+
+	UCIOpponent    Opponent
+	AdaptiveRating bool
+
+	// lichessSinceSet and lichessUntilSet are set once setoption sets Lichess_Since and Lichess_Until,
+	// rather than them being left at their defaults
+	lichessSinceSet bool
+	lichessUntilSet bool
+
+	config config.Config
+
 	fen         string
 	moves       []string
 	positionMtx sync.RWMutex
@@ -49,11 +115,22 @@ type Engine struct {
 	goRunning int64
 	goMtx     sync.Mutex
 	cancelGo  context.CancelFunc
+	ponderHit chan struct{}
+	goDone    chan struct{}
+
+	prefetchMtx    sync.Mutex
+	cancelPrefetch context.CancelFunc
 
 	extEngine *extengine.ExternalEngine
+	// extEngineLimited is set while the external engine's Skill Level is limited by UCI_Elo
+	extEngineLimited bool
+
+	rndSource  *lockedSource
+	rnd        *rand.Rand
+	activeSeed int64
 }
 
-func NewEngine() *Engine {
+func NewEngine(cfg config.Config) *Engine {
 	const (
 		defaultHash             = 16
 		defaultThreads          = 1
@@ -64,105 +141,94 @@ func NewEngine() *Engine {
 		defaultLichessRatingMax = 2500
 		defaultLichessSince     = "2012-12"
 		defaultLichessUntil     = ""
+
+		defaultLichessDatabase     = DatabaseLichess
+		defaultLichessMastersSince = 1952
+		defaultLichessMastersUntil = 0 // no limit
+
+		defaultMoveSelection            = SelectionProportional
+		defaultMoveSelectionTemperature = 100
+		defaultMoveSelectionTopN        = 3
+
+		defaultRandomSeed = 0
+
+		defaultLichessPlayer       = ""
+		defaultLichessPlayerWeight = 100
+
+		defaultBookFile = ""
+
+		defaultPGNDatabase = ""
+
+		defaultExternalEngineMultiPV = 1
+		defaultMoveSources           = "book>explorer>engine>random"
+
+		defaultUCIShowWDL = false
+
+		defaultBlunderThresholdCP = 0 // off
+		defaultBlunderSkipPercent = 0
+
+		defaultUCILimitStrength = false
+
+		defaultAdaptiveRating = false
 	)
 
+	rndSource := newLockedSource(1)
+
 	e := Engine{
-		fen: "startpos",
+		config:    cfg,
+		fen:       "startpos",
+		rndSource: rndSource,
+		rnd:       rand.New(rndSource),
 		UCIOptions: []UCIOption{
-			{
-				Name:    "Hash",
-				Type:    "spin",
-				Default: strconv.Itoa(defaultHash),
-				Min:     1,
-				Max:     33554432,
-			},
-			{
-				Name:    "Threads",
-				Type:    "spin",
-				Default: strconv.Itoa(defaultThreads),
-				Min:     1,
-				Max:     1024,
-			},
-			{
-				Name:    "MultiPV",
-				Type:    "spin",
-				Default: strconv.Itoa(defaultMultiPV),
-				Min:     1,
-				Max:     256,
-			},
-			{
-				Name:    "Contempt",
-				Type:    "spin",
-				Default: strconv.Itoa(defaultContempt),
-				Min:     -100,
-				Max:     100,
-			},
-			{
-				Name:    "Lichess_Speeds",
-				Type:    "string",
-				Default: defaultLichessSpeeds,
-			},
-			{
-				Name:      "Lichess_Rating_Min",
-				Type:      "combo",
-				Default:   strconv.Itoa(defaultLichessRatingMin),
-				ComboVars: []string{"0", "1000", "1200", "1400", "1600", "1800", "2000", "2200", "2500"},
-			},
-			{
-				Name:      "Lichess_Rating_Max",
-				Type:      "combo",
-				Default:   strconv.Itoa(defaultLichessRatingMax),
-				ComboVars: []string{"0", "1000", "1200", "1400", "1600", "1800", "2000", "2200", "2500"},
-			},
-			{
-				Name:    "Lichess_Since",
-				Type:    "string",
-				Default: defaultLichessSince,
-			},
-			{
-				Name:    "Lichess_Until",
-				Type:    "string",
-				Default: defaultLichessUntil,
-			},
+			spinOption("Hash", defaultHash, 1, 33554432, func(e *Engine) *int { return &e.Hash }),
+			spinOption("Threads", defaultThreads, 1, 1024, func(e *Engine) *int { return &e.Threads }),
+			spinOption("MultiPV", defaultMultiPV, 1, 256, func(e *Engine) *int { return &e.MultiPV }),
+			spinOption("Contempt", defaultContempt, -100, 100, func(e *Engine) *int { return &e.Contempt }),
+			lichessSpeedsOption("Lichess_Speeds", defaultLichessSpeeds, func(e *Engine) *lichess.Speeds { return &e.LichessSpeeds }),
+			lichessRatingOption("Lichess_Rating_Min", defaultLichessRatingMin, func(e *Engine) *lichess.Rating { return &e.LichessRatingMin }),
+			lichessRatingOption("Lichess_Rating_Max", defaultLichessRatingMax, func(e *Engine) *lichess.Rating { return &e.LichessRatingMax }),
+			lichessDateOption("Lichess_Since", defaultLichessSince, func(e *Engine) *lichess.Date { return &e.LichessSince }),
+			lichessDateOption("Lichess_Until", defaultLichessUntil, func(e *Engine) *lichess.Date { return &e.LichessUntil }),
+			comboOption("Lichess_Database", defaultLichessDatabase, validDatabases, func(e *Engine) *string { return &e.LichessDatabase }),
+			spinOption("Lichess_Masters_Since", defaultLichessMastersSince, 1952, 2100, func(e *Engine) *int { return &e.LichessMastersSince }),
+			spinOption("Lichess_Masters_Until", defaultLichessMastersUntil, 0, 2100, func(e *Engine) *int { return &e.LichessMastersUntil }),
+			comboOption("Move_Selection", defaultMoveSelection, validSelectionPolicies, func(e *Engine) *string { return &e.MoveSelection }),
+			spinOption("Move_Selection_Temperature", defaultMoveSelectionTemperature, 0, 1000, func(e *Engine) *int { return &e.MoveSelectionTemperature }),
+			spinOption("Move_Selection_Top_N", defaultMoveSelectionTopN, 1, 20, func(e *Engine) *int { return &e.MoveSelectionTopN }),
+			stringOption("Lichess_Player", defaultLichessPlayer, func(e *Engine) *string { return &e.LichessPlayer }),
+			spinOption("Lichess_Player_Weight", defaultLichessPlayerWeight, 0, 100, func(e *Engine) *int { return &e.LichessPlayerWeight }),
+			spinOption("Random_Seed", defaultRandomSeed, 0, maxRandomSeed, func(e *Engine) *int { return &e.RandomSeed }),
+			stringOption("ExternalEngine_Path", cfg.ExternalEngine.Path, func(e *Engine) *string { return &e.ExternalEnginePath }),
+			spinOption("ExternalEngine_MultiPV", defaultExternalEngineMultiPV, 1, 16, func(e *Engine) *int { return &e.ExternalEngineMultiPV }),
+			moveSourcesOption("Move_Sources", defaultMoveSources),
+			stringOption("Log_File", cfg.LogFile, func(e *Engine) *string { return &e.LogFile }),
+			bookFileOption("Book_File", defaultBookFile),
+			pgnDatabaseOption("PGN_Database", defaultPGNDatabase),
+			offlineOption("Offline", cfg.Offline),
+			checkOption("UCI_ShowWDL", defaultUCIShowWDL, func(e *Engine) *bool { return &e.UCIShowWDL }),
+			spinOption("Blunder_Threshold_CP", defaultBlunderThresholdCP, 0, 10000, func(e *Engine) *int { return &e.BlunderThresholdCP }),
+			spinOption("Blunder_Skip_Percent", defaultBlunderSkipPercent, 0, 100, func(e *Engine) *int { return &e.BlunderSkipPercent }),
+			checkOption("UCI_LimitStrength", defaultUCILimitStrength, func(e *Engine) *bool { return &e.UCILimitStrength }),
+			spinOption("UCI_Elo", defaultUCIElo, minUCIElo, maxUCIElo, func(e *Engine) *int { return &e.UCIElo }),
+			opponentOption("UCI_Opponent"),
+			checkOption("Adaptive_Rating", defaultAdaptiveRating, func(e *Engine) *bool { return &e.AdaptiveRating }),
 		},
 	}
 
+	// apply the defaults, and check each option reads back what it was set to
 	for _, uciOption := range e.UCIOptions {
-		setOption := fmt.Sprintf("setoption name %s value %s", uciOption.Name, uciOption.Default)
-		e.handleSetOption(setOption)
+		if err := uciOption.Set(&e, uciOption.Default); err != nil {
+			panic(fmt.Errorf("option %s: default '%s': %w", uciOption.Name, uciOption.Default, err))
+		}
+		if got := uciOption.Get(&e); got != uciOption.Default {
+			panic(fmt.Errorf("option %s: field '%s' != default '%s'", uciOption.Name, got, uciOption.Default))
+		}
 	}
 
-	// runtime self-check. could be moved to a unit test, but, y'know.
-	if e.Hash != defaultHash {
-		panic(fmt.Errorf("field Hash '%d' != default '%d'", e.Hash, defaultHash))
-	}
-	if e.Threads != defaultThreads {
-		panic(fmt.Errorf("field Threads '%d' != default '%d'", e.Threads, defaultThreads))
-	}
-	if e.MultiPV != defaultMultiPV {
-		panic(fmt.Errorf("field MultiPV '%d' != default '%d'", e.MultiPV, defaultMultiPV))
-	}
-	if e.Contempt != defaultContempt {
-		panic(fmt.Errorf("field Contempt '%d' != default '%d'", e.Contempt, defaultContempt))
-	}
-	if e.LichessSpeeds.String() != defaultLichessSpeeds {
-		panic(fmt.Errorf("field LichessSpeeds '%s' != default '%s'", e.LichessSpeeds, defaultLichessSpeeds))
-	}
-	if e.LichessRatingMin != defaultLichessRatingMin {
-		panic(fmt.Errorf("field LichessRatingMin '%d' != default '%d'", e.LichessRatingMin, defaultLichessRatingMin))
-	}
-	if e.LichessRatingMax != defaultLichessRatingMax {
-		panic(fmt.Errorf("field LichessRatingMax '%d' != default '%d'", e.LichessRatingMax, defaultLichessRatingMax))
-	}
-	if e.LichessSince.String() != defaultLichessSince {
-		panic(fmt.Errorf("field LichessSince '%s' != default '%s'", e.LichessSince.String(), defaultLichessSince))
-	}
-	if e.LichessUntil.String() != defaultLichessUntil {
-		panic(fmt.Errorf("field LichessUntil '%s' != default '%s'", e.LichessUntil.String(), defaultLichessUntil))
-	}
+	e.reseed()
 
 	if err := e.setupExternalEngine(); err != nil {
-		panic(err)
+		uciWriteLine(fmt.Sprintf("info string external engine disabled: %s", err.Error()))
 	}
 
 	return &e
@@ -193,9 +259,11 @@ func (e *Engine) ParseInput(line string) {
 	case "go":
 		e.handleGo(line)
 	case "ponderhit":
-		uciWriteLine("info string 'ponderhit' TODO")
+		e.handlePonderHit()
 	case "stop":
 		e.handleStop()
+	case "prefetch":
+		e.handlePrefetch(line)
 	case "show":
 		e.handleShow()
 	case "d":
@@ -224,9 +292,27 @@ func (e *Engine) handleUCI() {
 func (e *Engine) handleUCINewGame() {
 	e.handlePosition("position startpos")
 
-	if !e.extEngine.IsAlive() {
+	// Log_File and ExternalEngine_Path take effect here rather than in setoption so a game in
+	// progress isn't interrupted.
+	if e.LogFile != utils.LogFileName() && e.LogFile != "" {
+		if err := utils.SetLogFile(e.LogFile); err != nil {
+			uciWriteLine(fmt.Sprintf("info string %s", err.Error()))
+		}
+	}
+
+	e.reseed()
+	e.logRatingBands()
+
+	if e.extEngine != nil && (!e.extEngine.IsAlive() || !e.extEngine.IsPath(e.ExternalEnginePath)) {
+		if err := e.extEngine.Terminate(); err != nil {
+			utils.Log(fmt.Sprintf("external engine: failed to terminate: %s", err.Error()))
+		}
+		e.extEngine = nil
+	}
+
+	if e.extEngine == nil {
 		if err := e.setupExternalEngine(); err != nil {
-			panic(err)
+			uciWriteLine(fmt.Sprintf("info string external engine disabled: %s", err.Error()))
 		}
 	} else {
 		if err := e.setupExternalEnginePersonality(); err != nil {
@@ -235,145 +321,58 @@ func (e *Engine) handleUCINewGame() {
 	}
 }
 
-func (e *Engine) handleIsReady() {
-	for {
-		if atomic.LoadInt64(&e.goRunning) == 0 {
-			e.goMtx.Lock()
-			cancelFuncIsNil := e.cancelGo == nil
-			e.goMtx.Unlock()
-
-			if cancelFuncIsNil {
-				uciWriteLine("readyok")
-				return
-			}
-		}
-
-		utils.Log("engine is not ready")
-		time.Sleep(100 * time.Millisecond)
+// reseed restarts the random source from Random_Seed, or from the clock if it's 0. Replaying a game
+// with the logged seed and the same cache makes the same moves.
+func (e *Engine) reseed() {
+	seed := int64(e.RandomSeed)
+	if seed == 0 {
+		seed = clockSeed()
 	}
+
+	e.rndSource.Seed(seed)
+	atomic.StoreInt64(&e.activeSeed, seed)
+
+	utils.Log(fmt.Sprintf("random seed: %d", seed))
+}
+
+func (e *Engine) handleIsReady() {
+	// 'go' runs in the background, so there's nothing to wait for; the GUI expects readyok even mid-search.
+	uciWriteLine("readyok")
 }
 
 func (e *Engine) handleSetOption(line string) {
 	name, value, err := parseSetOption(line)
 	if err != nil {
+		uciWriteLine(fmt.Sprintf("info string %s", err.Error()))
 		return
 	}
 
-	// check setoption name found in list
-	var uciOption UCIOption
-	for i := 0; i < len(e.UCIOptions); i++ {
-		if strings.EqualFold(e.UCIOptions[i].Name, name) {
-			uciOption = e.UCIOptions[i]
-			break
-		}
+	uciOption, ok := e.findUCIOption(name)
+	if !ok {
+		uciWriteLine(fmt.Sprintf("info string unknown option '%s'", name))
+		return
 	}
 
-	// setoption name not found in list
-	if uciOption.Name == "" {
+	if err := uciOption.Set(e, value); err != nil {
+		uciWriteLine(fmt.Sprintf("info string option %s rejected: %s", uciOption.Name, err.Error()))
 		return
 	}
 
-	switch uciOption.Type {
-	case "spin":
-		// int
-		n, err := strconv.Atoi(value)
-		if err != nil {
-			return
-		}
-
-		if n < uciOption.Min || n > uciOption.Max {
-			return
-		}
-
-		switch strings.ToLower(uciOption.Name) {
-		case "hash":
-			e.Hash = n
-		case "threads":
-			e.Threads = n
-		case "multipv":
-			e.MultiPV = n
-		case "contempt":
-			e.Contempt = n
-		}
-
-	case "string":
-		switch strings.ToLower(uciOption.Name) {
-		case "lichess_speeds":
-			speeds := strings.Split(value, ",")
-			lichessSpeeds := make(lichess.Speeds, 0, len(speeds))
-			for _, speed := range speeds {
-				// check valid enum value
-				canonical, ok := lichess.ValidSpeeds.Contains(speed)
-				if !ok {
-					continue
-				}
-				// check not duplicate
-				if _, ok := lichessSpeeds.Contains(speed); ok {
-					continue
-				}
-
-				lichessSpeeds = append(lichessSpeeds, canonical)
-			}
-
-			if len(lichessSpeeds) == 0 {
-				return
-			}
-
-			sort.Sort(lichessSpeeds)
-
-			e.LichessSpeeds = lichessSpeeds
-
-		case "lichess_since":
-			if value == "" {
-				e.LichessSince = lichess.Date{Year: 0, Month: 0}
-			} else {
-				dt, err := time.Parse("2006-01", value)
-				if err != nil {
-					e.LichessSince = lichess.Date{Year: 0, Month: 0}
-					return
-				}
-				e.LichessSince = lichess.Date{Year: dt.Year(), Month: int(dt.Month())}
-			}
-		case "lichess_until":
-			if value == "" {
-				e.LichessUntil = lichess.Date{Year: 0, Month: 0}
-			} else {
-				dt, err := time.Parse("2006-01", value)
-				if err != nil {
-					e.LichessUntil = lichess.Date{Year: 0, Month: 0}
-					return
-				}
-				e.LichessUntil = lichess.Date{Year: dt.Year(), Month: int(dt.Month())}
-			}
-		}
-
-	case "combo":
-		var selectedValue string
-		for _, comboValue := range uciOption.ComboVars {
-			if strings.EqualFold(value, comboValue) {
-				selectedValue = comboValue
-				break
-			}
-		}
-		if selectedValue == "" {
-			return
-		}
+	switch uciOption.Name {
+	case "Lichess_Since":
+		e.lichessSinceSet = true
+	case "Lichess_Until":
+		e.lichessUntilSet = true
+	}
+}
 
-		switch strings.ToLower(uciOption.Name) {
-		case "lichess_rating_min":
-			canonical, ok := lichess.ValidRatings.Contains(selectedValue)
-			if !ok {
-				return
-			}
-			e.LichessRatingMin = canonical
-		case "lichess_rating_max":
-			canonical, ok := lichess.ValidRatings.Contains(selectedValue)
-			if !ok {
-				return
-			}
-			e.LichessRatingMax = canonical
+func (e *Engine) findUCIOption(name string) (UCIOption, bool) {
+	for _, uciOption := range e.UCIOptions {
+		if strings.EqualFold(uciOption.Name, name) {
+			return uciOption, true
 		}
 	}
+	return UCIOption{}, false
 }
 
 func parseSetOption(line string) (string, string, error) {
@@ -411,15 +410,21 @@ func parseSetOption(line string) (string, string, error) {
 
 func (e *Engine) handleShow() {
 	var sb strings.Builder
-	sb.WriteString(fmt.Sprintf("info string option name %s value %d\n", "Hash", e.Hash))
-	sb.WriteString(fmt.Sprintf("info string option name %s value %d\n", "Threads", e.Threads))
-	sb.WriteString(fmt.Sprintf("info string option name %s value %d\n", "MultiPV", e.MultiPV))
-	sb.WriteString(fmt.Sprintf("info string option name %s value %d\n", "Contempt", e.Contempt))
-	sb.WriteString(fmt.Sprintf("info string option name %s value %s\n", "Lichess_Speeds", e.LichessSpeeds.String()))
-	sb.WriteString(fmt.Sprintf("info string option name %s value %d\n", "Lichess_Rating_Min", e.LichessRatingMin))
-	sb.WriteString(fmt.Sprintf("info string option name %s value %d\n", "Lichess_Rating_Max", e.LichessRatingMax))
-	sb.WriteString(fmt.Sprintf("info string option name %s value %s\n", "Lichess_Since", e.LichessSince.String()))
-	sb.WriteString(fmt.Sprintf("info string option name %s value %s\n", "Lichess_Until", e.LichessUntil.String()))
+	for _, uciOption := range e.UCIOptions {
+		sb.WriteString(fmt.Sprintf("info string option name %s value %s\n", uciOption.Name, uciOption.Get(e)))
+	}
+	sb.WriteString(fmt.Sprintf("info string random seed %d\n", atomic.LoadInt64(&e.activeSeed)))
+	ratings, reason := e.ratingBands()
+	sb.WriteString(fmt.Sprintf("info string rating bands %s from %s\n", ratings, reason))
+
+	for _, state := range httpcache.LimiterStates() {
+		sb.WriteString(fmt.Sprintf("info string ratelimit host %s tokens %.1f burst %d rate %g/s",
+			state.Host, state.Tokens, state.Burst, state.PerSecond))
+		if !state.BlockedUntil.IsZero() {
+			sb.WriteString(fmt.Sprintf(" blocked %dms", time.Until(state.BlockedUntil).Milliseconds()))
+		}
+		sb.WriteString("\n")
+	}
 
 	uciWriteLine(sb.String())
 }
@@ -507,17 +512,6 @@ func (e *Engine) handleD() {
 }
 
 func (e *Engine) handleGo(line string) {
-	if !atomic.CompareAndSwapInt64(&e.goRunning, 0, 1) {
-		return
-	}
-
-	defer func() {
-		atomic.StoreInt64(&e.goRunning, 0)
-		e.goMtx.Lock()
-		e.cancelGo = nil
-		e.goMtx.Unlock()
-	}()
-
 	start := time.Now()
 
 	args, parseErr := parseGo(line)
@@ -526,15 +520,12 @@ func (e *Engine) handleGo(line string) {
 		return
 	}
 
-	_ = args // TODO: maybe handle the args?
-
-	ctx, cancel := context.WithTimeout(context.Background(), 5000*time.Millisecond)
-	defer cancel()
-
-	e.goMtx.Lock()
-	e.cancelGo = cancel
-	e.goMtx.Unlock()
+	if !atomic.CompareAndSwapInt64(&e.goRunning, 0, 1) {
+		uciWriteLine("info string search already running, ignoring 'go'")
+		return
+	}
 
+	// read the position before returning so a 'position' sent during the search can't change it
 	startFEN, moves := e.readPosition()
 
 	bb, err := bitboard.ParseFEN(startFEN)
@@ -548,118 +539,184 @@ func (e *Engine) handleGo(line string) {
 		panic(err)
 	}
 
-	fen := bb.FEN()
+	settings := e.searchSettings(startFEN, moves, bb.ActiveColor)
 
-	var wg sync.WaitGroup
-	wg.Add(4)
+	// stopCtx is canceled by 'stop' or 'quit'. the lookups get a child context bounded by the move budget.
+	stopCtx, stop := context.WithCancel(context.Background())
+	ponderHit := make(chan struct{})
+	done := make(chan struct{})
 
-	var (
-		suggestedMove     lichess.OpeningExplorerMove
-		cloudEval         lichess.CloudEvalResponse
-		queryAll          chessdb.QueryAllResponse
-		externalEngineUCI string
-	)
+	e.goMtx.Lock()
+	e.cancelGo = stop
+	e.ponderHit = ponderHit
+	e.goDone = done
+	e.goMtx.Unlock()
 
 	go func() {
-		defer wg.Done()
+		defer close(done)
 
-		job := extengine.AnalysisRequest{
-			RequestID:  NewID(),
-			InitialFEN: fen,
-			MultiPV:    1,
-			MoveTime:   1000,
-		}
+		msg := e.search(stopCtx, ponderHit, start, args, settings, startFEN, moves, bb)
 
-		responses := make(chan extengine.AnalysisResponse, bufferedChannelSize)
+		stop()
 
-		jobStarted := make(chan struct{})
+		e.goMtx.Lock()
+		e.cancelGo = nil
+		e.ponderHit = nil
+		e.goMtx.Unlock()
 
-		go func() {
-			analysisStream, err := e.extEngine.Analyze(ctx, job, jobStarted)
-			if err != nil {
-				utils.Log(fmt.Sprintf("external engine: error: %s", err.Error()))
-			}
+		// a GUI can send the next 'go' as soon as it reads bestmove, so the search has to be over first
+		atomic.StoreInt64(&e.goRunning, 0)
+		uciWriteLine(msg)
+	}()
+}
 
-			go func() {
-				defer func() {
-					responses <- extengine.AnalysisResponse{RequestID: job.RequestID, End: true}
-				}()
-
-				for {
-					select {
-					case <-ctx.Done():
-						return
-					case lineItem, ok := <-analysisStream:
-						if !ok {
-							return
-						}
-						responses <- extengine.AnalysisResponse{RequestID: job.RequestID, Line: lineItem}
-					}
-				}
-			}()
-		}()
+// searchSettings are the options a search reads. handleGo copies them from the Engine, so a setoption or
+// ucinewgame sent during the search doesn't change them underneath it.
+type searchSettings struct {
+	policy             SelectionPolicy
+	pipeline           movePipeline
+	multiPV            int
+	showWDL            bool
+	blunderThresholdCP int
+	blunderSkipPercent int
+
+	book *polyglot.Book
+
+	// ucinewgame may replace the external engine; the search keeps using the one it started with
+	extEngine        *extengine.ExternalEngine
+	extEngineMultiPV int
+
+	limitStrength bool
+	elo           int
+
+	database       string
+	pgnDB          *pgndb.Database
+	request        lichess.OpeningExplorerRequest
+	mastersRequest lichess.MastersExplorerRequest
+	// playerRequest is for the side to move. Player is empty if Lichess_Player isn't used.
+	playerRequest lichess.PlayerExplorerRequest
+	playerWeight  int
+}
 
-		select {
-		case <-jobStarted:
-			utils.Log(fmt.Sprintf("external engine: received 'job started'"))
-			break
-		case <-ctx.Done():
-			return
+func (e *Engine) searchSettings(fen string, moves []string, side bitboard.Color) searchSettings {
+	s := searchSettings{
+		policy:             newSelectionPolicy(e.MoveSelection, e.MoveSelectionTemperature, e.MoveSelectionTopN),
+		pipeline:           e.movePipeline,
+		multiPV:            e.MultiPV,
+		showWDL:            e.UCIShowWDL,
+		blunderThresholdCP: e.BlunderThresholdCP,
+		blunderSkipPercent: e.BlunderSkipPercent,
+		book:               e.book,
+		extEngine:          e.extEngine,
+		extEngineMultiPV:   e.ExternalEngineMultiPV,
+		limitStrength:      e.UCILimitStrength,
+		elo:                e.UCIElo,
+		database:           e.LichessDatabase,
+		pgnDB:              e.pgnDB,
+		request:            e.lichessRequest(fen, moves),
+		mastersRequest: lichess.MastersExplorerRequest{
+			FEN:   fen,
+			Play:  strings.Join(moves, ","),
+			Since: e.LichessMastersSince,
+			Until: e.LichessMastersUntil,
+		},
+	}
+
+	if e.LichessPlayer != "" && e.LichessPlayerWeight > 0 {
+		color := lichess.White
+		if side == bitboard.Black {
+			color = lichess.Black
 		}
 
-		for resp := range responses {
-			if resp.End {
-				utils.Log(fmt.Sprintf("external engine: received 'job ended'"))
-				break
-			}
+		s.playerRequest = lichess.PlayerExplorerRequest{
+			Player: e.LichessPlayer,
+			Color:  color,
+			FEN:    fen,
+			Play:   strings.Join(moves, ","),
+			Speeds: e.LichessSpeeds,
+			Since:  e.LichessSince,
+			Until:  e.LichessUntil,
+		}
+		s.playerWeight = e.LichessPlayerWeight
+	}
 
-			if strings.HasPrefix(line, "bestmove ") {
-				line = strings.TrimPrefix(line, "bestmove ")
-				idx := strings.Index(line, " ")
-				if idx != -1 {
-					line = line[:idx]
-				}
-				externalEngineUCI = line
-				continue
-			}
+	return s
+}
 
-			if strings.Contains(line, "multipv") && !strings.Contains(line, "multipv 1") {
-				continue
-			}
+// search runs the lookups for a 'go' command and returns the info lines and bestmove. For 'go infinite'
+// and 'go ponder' it doesn't return until 'stop' or 'ponderhit', as the UCI protocol requires.
+func (e *Engine) search(stopCtx context.Context, ponderHit <-chan struct{}, start time.Time, args GoArgs, settings searchSettings, startFEN string, moves []string, bb bitboard.Board) string {
+	budget := moveBudget(args, bb.ActiveColor)
+	utils.Log(fmt.Sprintf("go: move budget %dms", budget.Milliseconds()))
 
-			idx := strings.Index(resp.Line, " pv ")
-			if idx == -1 {
-				continue
-			}
-			line = resp.Line[idx+4:]
+	ctx, cancel := context.WithTimeout(stopCtx, budget)
+	defer cancel()
 
-			idx = strings.Index(line, " ")
-			if idx != -1 {
-				line = line[:idx]
-			}
-			externalEngineUCI = line
-		}
-	}()
+	fen := bb.FEN()
 
-	go func() {
-		defer wg.Done()
+	policy := settings.policy
+
+	// draw the request ID before starting the lookups so the random sequence doesn't depend on which
+	// goroutine gets there first
+	extEngineRequestID := NewID(e.rnd)
+	guardBlunders := settings.blunderThresholdCP > 0 && e.rnd.Intn(100) >= settings.blunderSkipPercent
+	// the explorer source draws on its own goroutine while choose samples, so it gets its own random
+	// sequence
+	explorerRnd := rand.New(rand.NewSource(e.rnd.Int63()))
 
-		var lichessErr error
+	var (
+		cloudEval lichess.CloudEvalResponse
+		queryAll  chessdb.QueryAllResponse
+
+		skipped skippedSources
+	)
 
-		suggestedMove, lichessErr = e.searchLichess(ctx, startFEN, moves)
-		if lichessErr != nil {
-			uciWriteLine(fmt.Sprintf("info string lichess api error: %s", lichessErr.Error()))
+	explorerSource := &explorerMoveSource{
+		settings: settings,
+		side:     bb.ActiveColor,
+		skipped:  &skipped,
+		rnd:      explorerRnd,
+	}
+
+	engineSource := &engineMoveSource{
+		extEngine: settings.extEngine,
+		job: extengine.AnalysisRequest{
+			RequestID:  extEngineRequestID,
+			InitialFEN: fen,
+			MultiPV:    settings.extEngineMultiPV,
+			MoveTime:   extEngineMoveTime(budget),
+		},
+	}
+
+	// an engine that can't play at UCI_Elo is weakened by sampling from more lines, more loosely
+	if settings.limitStrength && settings.extEngine != nil && !externalEngineLimitsStrength(settings.extEngine) {
+		if engineSource.job.MultiPV < limitStrengthMultiPV {
+			engineSource.job.MultiPV = limitStrengthMultiPV
 		}
-	}()
+		engineSource.weightScale = limitStrengthScoreScale(settings.elo)
+	}
+
+	sources := map[string]MoveSource{
+		MoveSourceBook:      bookMoveSource{book: settings.book, board: bb},
+		MoveSourceExplorer:  explorerSource,
+		MoveSourceEngine:    engineSource,
+		MoveSourceCloudEval: cloudEvalMoveSource{board: bb},
+		MoveSourceChessDB:   chessDBMoveSource{fen: fen},
+		MoveSourceRandom:    randomMoveSource{board: bb},
+	}
+
+	// the evaluations are looked up for the score whether or not they're move sources. the requests are
+	// shared with the move sources by httpcache.
+	var wg sync.WaitGroup
+	wg.Add(2)
 
 	go func() {
 		defer wg.Done()
 
-		const multiPV = 3
 		var cloudErr error
 
-		cloudEval, cloudErr = lichess.GetCloudEval(ctx, fen, multiPV)
-		if cloudErr != nil {
+		cloudEval, cloudErr = lichess.GetCloudEval(ctx, fen, cloudEvalMultiPV)
+		if cloudErr != nil && !skipped.skip("cloud_eval", cloudErr) {
 			// TODO: write warning?
 			//uciWriteLine(fmt.Sprintf("info string cloudeval api error: %s", cloudErr.Error()))
 		}
@@ -671,63 +728,118 @@ func (e *Engine) handleGo(line string) {
 		var chessdbErr error
 
 		queryAll, chessdbErr = chessdb.QueryAll(ctx, fen)
-		if chessdbErr != nil {
+		if chessdbErr != nil && !skipped.skip("chessdb", chessdbErr) {
 			// TODO: write warning?
 			//uciWriteLine(fmt.Sprintf("info string chessdb api error: %s", chessdbErr.Error()))
 		}
 	}()
 
-	wg.Wait()
+	// evaluations waits for the cloud eval and chessdb lookups. The engine's lines are only there once
+	// it's finished.
+	evaluations := func() moveEvaluations {
+		wg.Wait()
 
-	moveSource := "lichess_data"
-	uci := suggestedMove.UCI
-	if uci == "" || uci == "0000" {
-		if externalEngineUCI != "" && externalEngineUCI != "0000" {
-			// use external engine's move
-			moveSource = "external_engine"
-			uci = externalEngineUCI
-		} else {
-			// choose a random legal move
-			moveSource = "random_legal_move"
-			legalMoves := bb.LegalMoves()
-			uci = legalMoves[rand.Intn(len(legalMoves))]
+		evals := make(moveEvaluations)
+		evals.addCloudEval(bb, cloudEval)
+		evals.addQueryAll(queryAll)
+		evals.addEngine(engineSource.lines())
+		return evals
+	}
+
+	// the blunder guard goes with the cloud eval and chessdb if either has answered. Only if neither has
+	// does it wait for the engine, which is bounded by the move budget through ctx; if the engine isn't a
+	// move source this is what runs it.
+	guardEvaluations := func(ctx context.Context) moveEvaluations {
+		if evals := evaluations(); len(evals) > 0 {
+			return evals
 		}
+		_, _ = engineSource.Candidates(ctx)
+		return evaluations()
 	}
 
-	var cp, mate int
+	// the human sources can play blunders; the evaluation sources rank them low already
+	var guards []*blunderGuard
+	if guardBlunders {
+		for _, name := range []string{MoveSourceBook, MoveSourceExplorer} {
+			guard := &blunderGuard{source: sources[name], threshold: settings.blunderThresholdCP, evals: guardEvaluations}
+			sources[name] = guard
+			guards = append(guards, guard)
+		}
+	} else if settings.blunderThresholdCP > 0 {
+		utils.Log("blunder guard: skipped for this move")
+	}
 
-	for _, pv := range cloudEval.PVs {
-		pvUCI := strings.Split(pv.MovesUCI, " ")[0]
-		if pvUCI == uci {
-			cp, mate = pv.CP, pv.Mate
-			break
+	report := func(name string, err error) {
+		if skipped.skip(name, err) {
+			return
 		}
+		uciWriteLine(fmt.Sprintf("info string %s error: %s", name, err.Error()))
 	}
 
-	// allow chessdb to clobber lichess cloud evals
-	for _, chessDBMove := range queryAll.Moves {
-		if chessDBMove.UCI == suggestedMove.UCI || chessDBMove.SAN == suggestedMove.SAN {
-			cp = chessDBMove.Score
-			break
+	chosen, ok := settings.pipeline.choose(ctx, sources, e.rnd, report)
+	if !ok {
+		// a pipeline without "random" can run out of moves, but there has to be a bestmove
+		candidates, _ := sources[MoveSourceRandom].Candidates(ctx)
+		if len(candidates) > 0 {
+			chosen = candidates[e.rnd.Intn(len(candidates))]
+		} else {
+			// checkmate or stalemate: UCI has no move to send, so the GUI gets the null move
+			chosen = Candidate{UCI: nullMove, Source: "none"}
 		}
 	}
 
-	var score string
-	if mate == 0 {
-		score = fmt.Sprintf("cp %d", cp)
-	} else {
-		score = fmt.Sprintf("mate %d", mate)
+	wg.Wait()
+
+	if args.Infinite || args.Ponder {
+		select {
+		case <-stopCtx.Done():
+		case <-ponderHit:
+		}
 	}
 
+	moveSource := chosen.Source
+	uci := chosen.UCI
+
+	evals := evaluations()
+
+	ev, evOK := evals.best(uci)
+	depth, score := evalInfo(ev, evOK, settings.showWDL)
+
 	ms := time.Since(start).Milliseconds()
-	msg := fmt.Sprintf("info depth %d time %d score %s pv %s\n"+
-		"info string movesource %s move %s\n"+
+
+	explorer := explorerSource.response()
+
+	var msg string
+	switch multiPV := settings.multiPV; {
+	case uci == nullMove:
+		// there's no line to report
+	case multiPV > 1 && len(explorer.Moves) > 0:
+		msg = multiPVInfo(explorer, uci, evals, settings.showWDL, multiPV, ms)
+	default:
+		msg = fmt.Sprintf("info depth %d time %d%s pv %s\n", depth, ms, score, uci)
+	}
+
+	if evOK {
+		win, draw, loss := ev.WDL()
+		msg += fmt.Sprintf("info string eval source %s depth %d score %s wdl %d %d %d\n", ev.Source, ev.Depth, ev.Score(), win, draw, loss)
+	}
+
+	for _, guard := range guards {
+		if vetoed := guard.String(); vetoed != "" {
+			msg += fmt.Sprintf("info string blunder guard threshold %d vetoed %s\n", settings.blunderThresholdCP, vetoed)
+		}
+	}
+
+	if names := skipped.String(); names != "" {
+		msg += fmt.Sprintf("info string offline, not cached: %s\n", names)
+	}
+
+	msg += fmt.Sprintf("info string movesource %s policy %s move %s\n"+
 		"bestmove %s\n",
-		18, ms, score, uci,
-		moveSource, uci,
+		moveSource, policy.Name(), uci,
 		uci,
 	)
-	uciWriteLine(msg)
+	return msg
 }
 
 type GoArgs struct {
@@ -845,12 +957,48 @@ loop:
 	return goArgs, nil
 }
 
-func (e *Engine) searchLichess(ctx context.Context, fen string, moves []string) (lichess.OpeningExplorerMove, error) {
-	speeds := e.LichessSpeeds
+// lichessRequest builds a Lichess database request using the Lichess_* filter options, with the ratings
+// from ratingBands.
+func (e *Engine) lichessRequest(fen string, moves []string) lichess.OpeningExplorerRequest {
+	ratings, _ := e.ratingBands()
+
+	since, until := e.LichessSince, e.LichessUntil
+	// the default dates follow the Lichess database; a PGN database can be older or undated
+	if e.LichessDatabase == DatabasePGN {
+		if !e.lichessSinceSet {
+			since = lichess.Date{}
+		}
+		if !e.lichessUntilSet {
+			until = lichess.Date{}
+		}
+	}
+
+	return lichess.OpeningExplorerRequest{
+		FEN:     fen,
+		Play:    strings.Join(moves, ","),
+		Speeds:  e.LichessSpeeds,
+		Ratings: ratings,
+		Since:   since,
+		Until:   until,
+	}
+}
+
+// ratingBands returns the rating buckets the Lichess database is queried with and what chose them:
+// UCI_LimitStrength's buckets either side of UCI_Elo, Adaptive_Rating's window around the UCI_Opponent
+// rating, or Lichess_Rating_Min/Max.
+func (e *Engine) ratingBands() (lichess.Ratings, string) {
+	if e.UCILimitStrength {
+		return limitStrengthRatings(e.UCIElo), "UCI_Elo"
+	}
+
 	minRating := e.LichessRatingMin
 	maxRating := e.LichessRatingMax
-	since := e.LichessSince
-	until := e.LichessUntil
+	reason := "Lichess_Rating_Min/Max"
+
+	if e.AdaptiveRating && e.UCIOpponent.Elo > 0 {
+		minRating, maxRating = adaptiveRatingWindow(e.UCIOpponent.Elo)
+		reason = fmt.Sprintf("Adaptive_Rating opponent %d", e.UCIOpponent.Elo)
+	}
 
 	if int(minRating) > int(maxRating) {
 		minRating, maxRating = maxRating, minRating
@@ -863,69 +1011,182 @@ func (e *Engine) searchLichess(ctx context.Context, fen string, moves []string)
 		}
 	}
 
-	req := lichess.OpeningExplorerRequest{
-		FEN:     fen,
-		Play:    strings.Join(moves, ","),
-		Speeds:  speeds,
-		Ratings: ratings,
-		Since:   since,
-		Until:   until,
+	return ratings, reason
+}
+
+func (e *Engine) logRatingBands() {
+	ratings, reason := e.ratingBands()
+	utils.Log(fmt.Sprintf("rating bands: %s from %s", ratings, reason))
+}
+
+// searchLichess looks the position up in the explorer. If Lichess_Player is set, that player's own games
+// are used Lichess_Player_Weight percent of the time, falling back to the population database once the
+// player's tree runs out. On error the source is still returned, so the caller can say which one failed.
+// rnd must not be shared with other goroutines.
+func searchLichess(ctx context.Context, settings searchSettings, rnd *rand.Rand, skipped *skippedSources) (lichess.OpeningExplorerResponse, string, error) {
+	var (
+		playerResp lichess.OpeningExplorerResponse
+		wg         sync.WaitGroup
+	)
+
+	if settings.playerRequest.Player != "" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			var err error
+			playerResp, err = lichess.GetPlayerGames(ctx, settings.playerRequest)
+			if err != nil && !skipped.skip("lichess_player", err) {
+				uciWriteLine(fmt.Sprintf("info string lichess player api error: %s", err.Error()))
+			}
+		}()
+	}
+
+	req := settings.request
+	if settings.limitStrength {
+		// one bucket per move, so a game follows the interpolation between them
+		req.Ratings = lichess.Ratings{pickRatingBucket(settings.elo, rnd)}
+		utils.Log(fmt.Sprintf("limit strength: elo %d ratings %s", settings.elo, req.Ratings))
+	}
+
+	resp, source, err := getDatabaseGames(ctx, settings.database, settings.pgnDB, req, settings.mastersRequest, skipped)
+
+	wg.Wait()
+
+	if len(playerResp.Moves) > 0 && rnd.Intn(100) < settings.playerWeight {
+		return playerResp, "lichess_player", nil
 	}
 
-	resp, err := lichess.GetLichessGames(ctx, req)
 	if err != nil {
-		return lichess.OpeningExplorerMove{}, xerrors.Errorf("%w", err)
+		return lichess.OpeningExplorerResponse{}, source, xerrors.Errorf("%w", err)
 	}
 
-	suggestedMove := getSuggestedMove(resp)
-	return suggestedMove, nil
+	return resp, source, nil
+}
+
+// getDatabaseGames queries the Lichess_Database. "blend" queries both and uses the masters games while
+// there are enough of them, so the early opening follows masters theory and the lichess population
+// takes over deeper in. "pgn" queries the PGN_Database instead of the Lichess API.
+func getDatabaseGames(ctx context.Context, database string, pgnDB *pgndb.Database, req lichess.OpeningExplorerRequest, mastersReq lichess.MastersExplorerRequest, skipped *skippedSources) (lichess.OpeningExplorerResponse, string, error) {
+	switch database {
+	case DatabasePGN:
+		if pgnDB == nil {
+			return lichess.OpeningExplorerResponse{}, "pgn_database", xerrors.Errorf("Lichess_Database is %s but no PGN_Database is loaded", DatabasePGN)
+		}
+		resp, err := pgnDB.GetGames(ctx, req)
+		return resp, "pgn_database", err
+	case DatabaseMasters:
+		resp, err := lichess.GetMastersGames(ctx, mastersReq)
+		return resp, "lichess_masters", err
+	case DatabaseBlend:
+		var (
+			mastersResp lichess.OpeningExplorerResponse
+			mastersErr  error
+			wg          sync.WaitGroup
+		)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			mastersResp, mastersErr = lichess.GetMastersGames(ctx, mastersReq)
+		}()
+
+		resp, err := lichess.GetLichessGames(ctx, req)
+
+		wg.Wait()
+
+		if mastersErr != nil {
+			if !skipped.skip("lichess_masters", mastersErr) {
+				uciWriteLine(fmt.Sprintf("info string lichess masters api error: %s", mastersErr.Error()))
+			}
+		} else if mastersResp.Total() >= blendMastersMinGames {
+			return mastersResp, "lichess_masters", nil
+		}
+
+		return resp, "lichess_data", err
+	default:
+		resp, err := lichess.GetLichessGames(ctx, req)
+		return resp, "lichess_data", err
+	}
 }
 
 func (e *Engine) handleStop() {
+	e.stopSearch(stopSearchTimeout)
+}
+
+// stopSearch cancels the running search, if any, and waits up to timeout for its bestmove to be written.
+func (e *Engine) stopSearch(timeout time.Duration) {
 	e.goMtx.Lock()
 	if e.cancelGo != nil {
 		e.cancelGo()
 		e.cancelGo = nil
 	}
+	done := e.goDone
+	e.goMtx.Unlock()
+
+	if done == nil {
+		return
+	}
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		utils.Log("stop: timed out waiting for search to end")
+	}
+}
+
+func (e *Engine) handlePonderHit() {
+	e.goMtx.Lock()
+	if e.ponderHit != nil {
+		close(e.ponderHit)
+		e.ponderHit = nil
+	}
 	e.goMtx.Unlock()
 }
 
 func (e *Engine) handleQuit() {
 	utils.Log("shutting down...")
 
-	if err := e.extEngine.Terminate(); err != nil {
-		utils.Log(fmt.Sprintf("external engine: failed to terminated: %s", err.Error()))
-	}
+	e.stopSearch(quitTimeout)
+	e.stopPrefetch()
 
-	start := time.Now()
-	e.handleStop()
-	for atomic.LoadInt64(&e.goRunning) == 1 && time.Since(start) < 1500*time.Millisecond {
-		time.Sleep(50 * time.Millisecond)
+	if e.extEngine != nil {
+		if err := e.extEngine.Terminate(); err != nil {
+			utils.Log(fmt.Sprintf("external engine: failed to terminated: %s", err.Error()))
+		}
 	}
 
 	utils.Log("goodbye.")
 	os.Exit(0)
 }
 
-func NewID() string {
+func NewID(rnd *rand.Rand) string {
 	const alphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
 
 	var id string
 	for i := 0; i < 10; i++ {
-		id += string(alphabet[rand.Intn(len(alphabet))])
+		id += string(alphabet[rnd.Intn(len(alphabet))])
 	}
 
 	return id
 }
 
+// setupExternalEngine starts the engine at ExternalEnginePath. If it's empty AutoMock runs without an
+// external engine.
 func (e *Engine) setupExternalEngine() error {
-	extEngine, err := extengine.New(extengine.Opts{Threads: e.Threads, Hash: e.Hash, MultiPV: e.MultiPV, EnginePath: berserkPath})
+	if e.ExternalEnginePath == "" {
+		utils.Log("external engine: none configured")
+		return nil
+	}
+
+	extEngine, err := extengine.New(extengine.Opts{Threads: e.Threads, Hash: e.Hash, MultiPV: e.MultiPV, EnginePath: e.ExternalEnginePath})
 	if err != nil {
 		utils.Log(fmt.Sprintf("external engine: error: %s", err.Error()))
 		return xerrors.Errorf("%w", err)
 	}
 
 	e.extEngine = extEngine
+	e.extEngineLimited = false
 
 	if err := e.setupExternalEnginePersonality(); err != nil {
 		utils.Log(fmt.Sprintf("external engine: error: %s", err.Error()))
@@ -937,12 +1198,20 @@ func (e *Engine) setupExternalEngine() error {
 func (e *Engine) setupExternalEnginePersonality() error {
 	var setOptions []extengine.SetOption
 
-	if e.extEngine.IsPath(berserkPath) {
-		setOptions = []extengine.SetOption{
-			{Name: "Contempt", Value: strconv.Itoa(e.Contempt)},
+	// options from the config file are for the configured engine, not one picked with ExternalEngine_Path
+	if e.extEngine.IsPath(e.config.ExternalEngine.Path) {
+		for _, option := range e.config.ExternalEngine.Options {
+			setOptions = append(setOptions, extengine.SetOption{Name: option.Name, Value: option.Value})
 		}
 	}
 
+	if e.extEngine.HasOption("Contempt") {
+		setOptions = append(setOptions, extengine.SetOption{Name: "Contempt", Value: strconv.Itoa(e.Contempt)})
+	}
+
+	setOptions = append(setOptions, externalEngineStrengthOptions(e.extEngine, e.UCILimitStrength, e.UCIElo, e.extEngineLimited)...)
+	e.extEngineLimited = e.UCILimitStrength
+
 	if err := e.extEngine.SetOptions(setOptions); err != nil {
 		return xerrors.Errorf("%w", err)
 	}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"automock/config"
+	"automock/httpcache"
+	"automock/lichess"
+	"automock/store"
+)
+
+// testProcessEnv set to "uci" makes the test binary run the UCI loop offline instead of the tests, so a
+// test can talk to the engine as a GUI would. Set to "engine" it runs fakeExternalEngine instead.
+const testProcessEnv = "AUTOMOCK_TEST_PROCESS"
+
+// fakeEngineInfoEnv is the info lines fakeExternalEngine answers 'go' with, separated by '|'.
+const fakeEngineInfoEnv = "AUTOMOCK_TEST_ENGINE_INFO"
+
+func TestMain(m *testing.M) {
+	switch os.Getenv(testProcessEnv) {
+	case "uci":
+		httpcache.SetCacheDir(os.TempDir())
+		uciLoop(config.Config{Offline: true})
+		os.Exit(0)
+	case "engine":
+		fakeExternalEngine()
+		os.Exit(0)
+	}
+
+	os.Exit(m.Run())
+}
+
+// fakeExternalEngine is a UCI engine that answers every 'go' with the info lines in fakeEngineInfoEnv, and
+// plays the first move of the first line's pv.
+func fakeExternalEngine() {
+	infoLines := strings.Split(os.Getenv(fakeEngineInfoEnv), "|")
+
+	bestMove := nullMove
+	if _, pv, ok := strings.Cut(infoLines[0], " pv "); ok {
+		bestMove = strings.Fields(pv)[0]
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		command, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), " ")
+		switch command {
+		case "uci":
+			fmt.Println("id name fake")
+			fmt.Println("uciok")
+		case "isready":
+			fmt.Println("readyok")
+		case "go":
+			for _, line := range infoLines {
+				fmt.Println(line)
+			}
+			fmt.Printf("bestmove %s\n", bestMove)
+		case "quit":
+			return
+		}
+	}
+}
+
+func TestEngine_SearchCommands(t *testing.T) {
+	cases := []struct {
+		name     string
+		position string
+		goLine   string
+		commands []string
+		// want is the readyok and bestmove lines in the order they're written
+		want []string
+	}{
+		{
+			name:     "stop",
+			position: "position startpos",
+			goLine:   "go infinite",
+			commands: []string{"isready", "stop"},
+			want:     []string{"readyok", "bestmove"},
+		},
+		{
+			name:     "isready",
+			position: "position startpos",
+			goLine:   "go infinite",
+			commands: []string{"isready", "isready", "stop"},
+			want:     []string{"readyok", "readyok", "bestmove"},
+		},
+		{
+			name:     "ponderhit",
+			position: "position startpos",
+			goLine:   "go ponder wtime 60000 btime 60000",
+			commands: []string{"isready", "ponderhit"},
+			want:     []string{"readyok", "bestmove"},
+		},
+		{
+			name:     "quit",
+			position: "position startpos",
+			goLine:   "go infinite",
+			commands: []string{"isready", "quit"},
+			want:     []string{"readyok", "bestmove"},
+		},
+		{
+			name:     "setoption during search",
+			position: "position startpos",
+			goLine:   "go infinite",
+			commands: []string{
+				"setoption name MultiPV value 3",
+				"setoption name Move_Sources value explorer>random",
+				"setoption name Lichess_Player value someone",
+				"ucinewgame",
+				"isready",
+				"stop",
+			},
+			want: []string{"readyok", "bestmove"},
+		},
+		{
+			name:     "checkmate",
+			position: "position startpos moves f2f3 e7e5 g2g4 d8h4",
+			goLine:   "go movetime 100",
+			commands: []string{"isready"},
+			want:     []string{"bestmove 0000", "readyok"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// arrange
+			cmd := exec.Command(os.Args[0])
+			cmd.Env = append(os.Environ(), testProcessEnv+"=uci")
+			stdin, err := cmd.StdinPipe()
+			if err != nil {
+				t.Fatal(err)
+			}
+			stdout, err := cmd.StdoutPipe()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := cmd.Start(); err != nil {
+				t.Fatal(err)
+			}
+			defer cmd.Process.Kill()
+
+			lines := make(chan string)
+			go func() {
+				defer close(lines)
+				scanner := bufio.NewScanner(stdout)
+				for scanner.Scan() {
+					if line := scanner.Text(); strings.HasPrefix(line, "readyok") || strings.HasPrefix(line, "bestmove") {
+						lines <- line
+					}
+				}
+			}()
+
+			// act
+			input := []string{"setoption name Move_Sources value random", c.position, c.goLine}
+			for _, line := range append(input, c.commands...) {
+				if _, err := fmt.Fprintln(stdin, line); err != nil {
+					t.Fatal(err)
+				}
+				// give the engine time to act on each command, so a bestmove written too early shows up first
+				time.Sleep(50 * time.Millisecond)
+			}
+			stdin.Close()
+
+			var got []string
+			timeout := time.After(5 * time.Second)
+		read:
+			for {
+				select {
+				case line, ok := <-lines:
+					if !ok {
+						break read
+					}
+					got = append(got, line)
+				case <-timeout:
+					t.Fatalf("timed out, got: %v", got)
+				}
+			}
+
+			// assert
+			if len(c.want) != len(got) {
+				t.Fatalf("want: %v got: %v", c.want, got)
+			}
+			for i := range c.want {
+				if !strings.HasPrefix(got[i], c.want[i]) {
+					t.Errorf("want: %v got: %v", c.want, got)
+					break
+				}
+			}
+			if err := cmd.Wait(); err != nil {
+				t.Errorf("want a clean exit, got: %v", err)
+			}
+		})
+	}
+}
+
+func TestEngine_GoAfterBestmove(t *testing.T) {
+	// arrange
+	httpcache.SetCacheDir(t.TempDir())
+	defer httpcache.SetOffline(false)
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	e := NewEngine(config.Config{})
+	e.ParseInput("setoption name Offline value true")
+	e.ParseInput("setoption name Move_Sources value random")
+
+	// fill the pipe so writing bestmove blocks until the GUI reads it
+	go func() {
+		_, _ = w.Write([]byte(strings.Repeat("x", 1<<20) + "\n"))
+	}()
+
+	// act
+	e.ParseInput("go movetime 1")
+
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt64(&e.goRunning) != 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	running := atomic.LoadInt64(&e.goRunning)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 2<<20)
+	for scanner.Scan() && !strings.HasPrefix(scanner.Text(), "bestmove") {
+	}
+
+	// assert
+	if running != 0 {
+		t.Errorf("want the search over before bestmove is written")
+	}
+}
+
+func TestEngine_LichessRequestDates(t *testing.T) {
+	cases := []struct {
+		name      string
+		setoption []string
+		wantSince string
+		wantUntil string
+	}{
+		{
+			name:      "lichess defaults",
+			wantSince: "2012-12",
+		},
+		{
+			name:      "pgn ignores the default dates",
+			setoption: []string{"setoption name Lichess_Database value pgn"},
+		},
+		{
+			name: "pgn with dates set",
+			setoption: []string{
+				"setoption name Lichess_Database value pgn",
+				"setoption name Lichess_Since value 2012-12",
+				"setoption name Lichess_Until value 2020-06",
+			},
+			wantSince: "2012-12",
+			wantUntil: "2020-06",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// arrange
+			e := NewEngine(config.Config{})
+			for _, line := range c.setoption {
+				e.ParseInput(line)
+			}
+
+			// act
+			req := e.lichessRequest("startpos", nil)
+
+			// assert
+			if c.wantSince != req.Since.String() || c.wantUntil != req.Until.String() {
+				t.Errorf("want: %q, %q got: %q, %q", c.wantSince, c.wantUntil, req.Since.String(), req.Until.String())
+			}
+		})
+	}
+}
+
+func TestGetDatabaseGames(t *testing.T) {
+	lichessResp := lichess.OpeningExplorerResponse{White: 500, Draws: 100, Black: 400, Moves: []lichess.OpeningExplorerMove{{UCI: "e2e4", White: 500, Draws: 100, Black: 400}}}
+	mastersResp := func(games int) *lichess.OpeningExplorerResponse {
+		return &lichess.OpeningExplorerResponse{White: games, Moves: []lichess.OpeningExplorerMove{{UCI: "d2d4", White: games}}}
+	}
+
+	cases := []struct {
+		name        string
+		database    string
+		masters     *lichess.OpeningExplorerResponse
+		wantSource  string
+		wantMove    string
+		wantSkipped string
+	}{
+		{name: "lichess", database: DatabaseLichess, masters: mastersResp(1000), wantSource: "lichess_data", wantMove: "e2e4"},
+		{name: "masters", database: DatabaseMasters, masters: mastersResp(10), wantSource: "lichess_masters", wantMove: "d2d4"},
+		{name: "blend prefers masters", database: DatabaseBlend, masters: mastersResp(blendMastersMinGames), wantSource: "lichess_masters", wantMove: "d2d4"},
+		{name: "blend too few masters games", database: DatabaseBlend, masters: mastersResp(blendMastersMinGames - 1), wantSource: "lichess_data", wantMove: "e2e4"},
+		{name: "blend without masters", database: DatabaseBlend, wantSource: "lichess_data", wantMove: "e2e4", wantSkipped: "lichess_masters"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// arrange
+			req := lichess.OpeningExplorerRequest{FEN: "startpos"}
+			mastersReq := lichess.MastersExplorerRequest{FEN: "startpos"}
+
+			// offline, so the responses come from the store and nothing else is fetched
+			httpcache.SetCacheDir(t.TempDir())
+			httpcache.SetOffline(true)
+			defer httpcache.SetOffline(false)
+
+			s, err := store.Open(filepath.Join(t.TempDir(), "store.db"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+			lichess.SetStore(s, time.Hour)
+			defer lichess.SetStore(nil, 0)
+
+			putResponse(t, s, req.StoreKey(), lichessResp)
+			if c.masters != nil {
+				putResponse(t, s, mastersReq.StoreKey(), *c.masters)
+			}
+
+			var skipped skippedSources
+
+			// act
+			resp, source, err := getDatabaseGames(context.Background(), c.database, nil, req, mastersReq, &skipped)
+
+			// assert
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.wantSource != source {
+				t.Errorf("source want: %s got: %s", c.wantSource, source)
+			}
+			if len(resp.Moves) != 1 || c.wantMove != resp.Moves[0].UCI {
+				t.Errorf("move want: %s got: %+v", c.wantMove, resp.Moves)
+			}
+			if c.wantSkipped != skipped.String() {
+				t.Errorf("skipped want: %q got: %q", c.wantSkipped, skipped.String())
+			}
+		})
+	}
+}
+
+func putResponse(t *testing.T, s *store.Store, key store.Key, resp lichess.OpeningExplorerResponse) {
+	b, err := json.Marshal(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put(store.Entry{Key: key, Status: store.StatusOK, FetchedAt: time.Now(), Response: b}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"automock/bitboard"
+	"automock/chessdb"
+	"automock/lichess"
+)
+
+const (
+	// chessDBMateThreshold is the smallest chessdb score that's a mate. chessdb scores a mate n plies away
+	// as 30000-n.
+	chessDBMateThreshold = mateScore - 1000
+
+	// wdlMidpoint and wdlScale shape the win/draw/loss model: a side wdlMidpoint centipawns ahead wins
+	// half its games, and wdlScale sets how quickly that changes with the score.
+	wdlMidpoint = 200
+	wdlScale    = 100
+
+	// defaultInfoDepth is the depth reported when no evaluation says how deep it is
+	defaultInfoDepth = 18
+)
+
+// Evaluation is a score for a move from the point of view of the side to move. Mate is the number of
+// moves to mate, negative when the side to move is being mated; CP is only meaningful when Mate is 0.
+type Evaluation struct {
+	CP   int
+	Mate int
+	// Depth is the search depth, 0 if the source doesn't say.
+	Depth     int
+	FetchedAt time.Time
+	Source    string
+}
+
+// Score formats the evaluation for an "info ... score" line.
+func (ev Evaluation) Score() string {
+	if ev.Mate != 0 {
+		return fmt.Sprintf("mate %d", ev.Mate)
+	}
+	return fmt.Sprintf("cp %d", ev.CP)
+}
+
+// WDL estimates the win, draw and loss chances in permille.
+func (ev Evaluation) WDL() (int, int, int) {
+	switch {
+	case ev.Mate > 0:
+		return 1000, 0, 0
+	case ev.Mate < 0:
+		return 0, 0, 1000
+	}
+
+	win := int(math.Round(1000 / (1 + math.Exp(float64(wdlMidpoint-ev.CP)/wdlScale))))
+	loss := int(math.Round(1000 / (1 + math.Exp(float64(wdlMidpoint+ev.CP)/wdlScale))))
+	return win, 1000 - win - loss, loss
+}
+
+// cp returns the score in centipawns, with mates beyond any centipawn score.
+func (ev Evaluation) cp() int {
+	if ev.Mate != 0 {
+		return mateToCP(ev.Mate)
+	}
+	return ev.CP
+}
+
+// moveEvaluations collects the evaluations of each move in a position from every source.
+type moveEvaluations map[string][]Evaluation
+
+func (m moveEvaluations) add(uci string, ev Evaluation) {
+	m[uci] = append(m[uci], ev)
+}
+
+// addCloudEval adds the first move of each cloud eval line. Cloud evals are from white's point of view, and
+// write castling as the king taking its own rook.
+func (m moveEvaluations) addCloudEval(b bitboard.Board, cloudEval lichess.CloudEvalResponse) {
+	for _, pv := range cloudEval.PVs {
+		uci := b.NormalizeCastling(strings.Split(pv.MovesUCI, " ")[0])
+
+		ev := Evaluation{CP: pv.CP, Mate: pv.Mate, Depth: cloudEval.Depth, FetchedAt: cloudEval.FetchedAt, Source: "cloud_eval"}
+		if b.ActiveColor == bitboard.Black {
+			ev.CP, ev.Mate = -ev.CP, -ev.Mate
+		}
+		m.add(uci, ev)
+	}
+}
+
+// addQueryAll adds chessdb's scores, which are from the side to move's point of view. chessdb doesn't
+// report a depth.
+func (m moveEvaluations) addQueryAll(queryAll chessdb.QueryAllResponse) {
+	for _, move := range queryAll.Moves {
+		ev := Evaluation{FetchedAt: queryAll.FetchedAt, Source: "chessdb"}
+
+		switch score := move.Score; {
+		case score >= chessDBMateThreshold:
+			ev.Mate = (mateScore - score + 1) / 2
+		case score <= -chessDBMateThreshold:
+			ev.Mate = -(mateScore + score + 1) / 2
+		default:
+			ev.CP = score
+		}
+		m.add(move.UCI, ev)
+	}
+}
+
+// addEngine adds the first move of each external engine line.
+func (m moveEvaluations) addEngine(lines []engineLine, fetchedAt time.Time) {
+	for _, line := range lines {
+		m.add(line.Move, Evaluation{CP: line.CP, Mate: line.Mate, Depth: line.Depth, FetchedAt: fetchedAt, Source: "external_engine"})
+	}
+}
+
+// best returns the deepest evaluation of uci, the most recent one if the depths are equal.
+func (m moveEvaluations) best(uci string) (Evaluation, bool) {
+	evs := m[uci]
+	if len(evs) == 0 {
+		return Evaluation{}, false
+	}
+
+	evs = append([]Evaluation(nil), evs...)
+	sort.SliceStable(evs, func(i, j int) bool {
+		if evs[i].Depth != evs[j].Depth {
+			return evs[i].Depth > evs[j].Depth
+		}
+		return evs[i].FetchedAt.After(evs[j].FetchedAt)
+	})
+
+	return evs[0], true
+}
+
+// evalInfo returns the depth and the " score ..." part of an info line for ev, or no score if ok is false.
+func evalInfo(ev Evaluation, ok bool, showWDL bool) (int, string) {
+	if !ok {
+		return defaultInfoDepth, ""
+	}
+
+	depth := ev.Depth
+	if depth == 0 {
+		depth = defaultInfoDepth
+	}
+
+	score := " score " + ev.Score()
+	if showWDL {
+		win, draw, loss := ev.WDL()
+		score += fmt.Sprintf(" wdl %d %d %d", win, draw, loss)
+	}
+	return depth, score
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"automock/bitboard"
+	"automock/chessdb"
+	"automock/lichess"
+)
+
+func TestMoveEvaluations_Normalise(t *testing.T) {
+	fetchedAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name      string
+		fen       string
+		cloudEval lichess.CloudEvalResponse
+		queryAll  chessdb.QueryAllResponse
+		engine    []engineLine
+		uci       string
+		want      Evaluation
+	}{
+		{
+			name:      "cloud eval white to move",
+			fen:       "startpos",
+			cloudEval: lichess.CloudEvalResponse{Depth: 40, FetchedAt: fetchedAt, PVs: []lichess.CloudEvalPV{{MovesUCI: "e2e4 e7e5", CP: 30}}},
+			uci:       "e2e4",
+			want:      Evaluation{CP: 30, Depth: 40, FetchedAt: fetchedAt, Source: "cloud_eval"},
+		},
+		{
+			name:      "cloud eval black to move",
+			fen:       "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq - 0 1",
+			cloudEval: lichess.CloudEvalResponse{Depth: 40, PVs: []lichess.CloudEvalPV{{MovesUCI: "c7c5", CP: 30}, {MovesUCI: "f7f6", Mate: 5}}},
+			uci:       "f7f6",
+			want:      Evaluation{Mate: -5, Depth: 40, Source: "cloud_eval"},
+		},
+		{
+			name:      "cloud eval king takes rook",
+			fen:       "r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1",
+			cloudEval: lichess.CloudEvalResponse{Depth: 30, PVs: []lichess.CloudEvalPV{{MovesUCI: "e1h1", CP: 10}}},
+			uci:       "e1g1",
+			want:      Evaluation{CP: 10, Depth: 30, Source: "cloud_eval"},
+		},
+		{
+			name:     "chessdb cp",
+			fen:      "startpos",
+			queryAll: chessdb.QueryAllResponse{FetchedAt: fetchedAt, Moves: []chessdb.Move{{UCI: "d2d4", Score: 25}}},
+			uci:      "d2d4",
+			want:     Evaluation{CP: 25, FetchedAt: fetchedAt, Source: "chessdb"},
+		},
+		{
+			name:     "chessdb mates",
+			fen:      "startpos",
+			queryAll: chessdb.QueryAllResponse{Moves: []chessdb.Move{{UCI: "d1h5", Score: 29999}}},
+			uci:      "d1h5",
+			want:     Evaluation{Mate: 1, Source: "chessdb"},
+		},
+		{
+			name:     "chessdb mated next turn",
+			fen:      "startpos",
+			queryAll: chessdb.QueryAllResponse{Moves: []chessdb.Move{{UCI: "f2f3", Score: -29998}}},
+			uci:      "f2f3",
+			want:     Evaluation{Mate: -1, Source: "chessdb"},
+		},
+		{
+			name:   "engine",
+			fen:    "startpos",
+			engine: []engineLine{{MultiPV: 1, Depth: 22, Score: -15, CP: -15, Move: "g1f3"}},
+			uci:    "g1f3",
+			want:   Evaluation{CP: -15, Depth: 22, FetchedAt: fetchedAt, Source: "external_engine"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// arrange
+			b, err := bitboard.ParseFEN(c.fen)
+			if err != nil {
+				t.Fatal(err)
+			}
+			evals := make(moveEvaluations)
+
+			// act
+			evals.addCloudEval(b, c.cloudEval)
+			evals.addQueryAll(c.queryAll)
+			evals.addEngine(c.engine, fetchedAt)
+			got, ok := evals.best(c.uci)
+
+			// assert
+			if !ok || c.want != got {
+				t.Errorf("want: %+v got: %+v, %v", c.want, got, ok)
+			}
+		})
+	}
+}
+
+func TestMoveEvaluations_Best(t *testing.T) {
+	older := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	newer := older.Add(time.Hour)
+
+	cases := []struct {
+		name       string
+		evals      []Evaluation
+		wantSource string
+	}{
+		{
+			name:       "deepest",
+			evals:      []Evaluation{{Depth: 20, FetchedAt: newer, Source: "external_engine"}, {Depth: 40, FetchedAt: older, Source: "cloud_eval"}},
+			wantSource: "cloud_eval",
+		},
+		{
+			name:       "unknown depth loses",
+			evals:      []Evaluation{{FetchedAt: newer, Source: "chessdb"}, {Depth: 1, FetchedAt: older, Source: "external_engine"}},
+			wantSource: "external_engine",
+		},
+		{
+			name:       "freshest of equal depth",
+			evals:      []Evaluation{{Depth: 30, FetchedAt: older, Source: "cloud_eval"}, {Depth: 30, FetchedAt: newer, Source: "external_engine"}},
+			wantSource: "external_engine",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// arrange
+			evals := moveEvaluations{"e2e4": c.evals}
+
+			// act
+			got, ok := evals.best("e2e4")
+
+			// assert
+			if !ok || c.wantSource != got.Source {
+				t.Errorf("want: %s got: %s, %v", c.wantSource, got.Source, ok)
+			}
+		})
+	}
+}
+
+func TestEvaluation_WDL(t *testing.T) {
+	cases := []struct {
+		name string
+		ev   Evaluation
+		want [3]int
+	}{
+		{name: "equal", ev: Evaluation{CP: 0}, want: [3]int{119, 762, 119}},
+		{name: "winning", ev: Evaluation{CP: 200}, want: [3]int{500, 482, 18}},
+		{name: "losing", ev: Evaluation{CP: -200}, want: [3]int{18, 482, 500}},
+		{name: "mates", ev: Evaluation{Mate: 3}, want: [3]int{1000, 0, 0}},
+		{name: "mated", ev: Evaluation{Mate: -1}, want: [3]int{0, 0, 1000}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// act
+			win, draw, loss := c.ev.WDL()
+
+			// assert
+			if got := [3]int{win, draw, loss}; c.want != got {
+				t.Errorf("want: %v got: %v", c.want, got)
+			}
+		})
+	}
+}
@@ -27,6 +27,8 @@ type ExternalEngine struct {
 	name              string
 	uciVariant        string
 	supportedVariants []string
+	supportedOptions  map[string]struct{}
+	spinRanges        map[string]spinRange
 
 	process       *exec.Cmd
 	lastUsedEpoch int64
@@ -78,6 +80,8 @@ func New(opts Opts) (*ExternalEngine, error) {
 		name:              name,
 		process:           cmd,
 		supportedVariants: []string{},
+		supportedOptions:  make(map[string]struct{}),
+		spinRanges:        make(map[string]spinRange),
 		lastUsedEpoch:     time.Now().Unix(),
 		isAlive:           1,
 		stdin:             bufio.NewWriter(stdin),
@@ -215,6 +219,12 @@ func (e *ExternalEngine) uci() (string, error) {
 				name = strings.Join(parts[2:], " ")
 			}
 		} else if command == "option" {
+			if optionName := parseOptionName(line); optionName != "" {
+				e.supportedOptions[strings.ToLower(optionName)] = struct{}{}
+				if r, ok := parseSpinRange(line); ok {
+					e.spinRanges[strings.ToLower(optionName)] = r
+				}
+			}
 			for i := 1; i < len(parts); i++ {
 				if parts[i] == "name" && i+1 < len(parts) {
 					name := parts[i+1]
@@ -239,6 +249,63 @@ func (e *ExternalEngine) uci() (string, error) {
 	return name, nil
 }
 
+// parseOptionName returns the name from an "option name <name> type <type> ..." line. Names can contain spaces.
+func parseOptionName(line string) string {
+	start := strings.Index(line, " name ")
+	if start == -1 {
+		return ""
+	}
+	name := line[start+len(" name "):]
+
+	if end := strings.Index(name, " type "); end != -1 {
+		name = name[:end]
+	}
+
+	return strings.TrimSpace(name)
+}
+
+type spinRange struct {
+	min int
+	max int
+}
+
+// parseSpinRange returns the min and max from an "option name <name> type spin ... min <min> max <max>" line.
+func parseSpinRange(line string) (spinRange, bool) {
+	parts := strings.Fields(line)
+
+	var (
+		r              spinRange
+		isSpin         bool
+		hasMin, hasMax bool
+	)
+	for i := 0; i < len(parts)-1; i++ {
+		switch parts[i] {
+		case "type":
+			isSpin = parts[i+1] == "spin"
+		case "min":
+			n, err := strconv.Atoi(parts[i+1])
+			r.min, hasMin = n, err == nil
+		case "max":
+			n, err := strconv.Atoi(parts[i+1])
+			r.max, hasMax = n, err == nil
+		}
+	}
+
+	return r, isSpin && hasMin && hasMax
+}
+
+// SpinRange returns the range of a spin option the engine listed in its "uci" response.
+func (e *ExternalEngine) SpinRange(name string) (int, int, bool) {
+	r, ok := e.spinRanges[strings.ToLower(name)]
+	return r.min, r.max, ok
+}
+
+// HasOption returns true if the engine listed the option in its "uci" response.
+func (e *ExternalEngine) HasOption(name string) bool {
+	_, ok := e.supportedOptions[strings.ToLower(name)]
+	return ok
+}
+
 func (e *ExternalEngine) isReady() error {
 	if err := e.send("isready"); err != nil {
 		return xerrors.Errorf("%w", err)
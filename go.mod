@@ -3,6 +3,9 @@ module automock
 go 1.19
 
 require (
-	github.com/alecthomas/kong v1.2.1 // indirect
-	golang.org/x/xerrors v0.0.0-20240903120638-7835f813f4da // indirect
+	github.com/alecthomas/kong v1.2.1
+	go.etcd.io/bbolt v1.3.9
+	golang.org/x/xerrors v0.0.0-20240903120638-7835f813f4da
 )
+
+require golang.org/x/sys v0.4.0 // indirect
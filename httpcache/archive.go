@@ -0,0 +1,207 @@
+package httpcache
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+
+	"golang.org/x/xerrors"
+
+	"automock/utils"
+)
+
+// archiveName matches the files Export writes: xx/<key>.json and xx/<key>-metadata.json, where xx is the
+// first two digits of the key.
+var archiveName = regexp.MustCompile(`^([0-9a-f]{2})/(([0-9a-f]{2})[0-9a-f]{38})(-metadata)?\.json$`)
+
+// ImportResult counts what Import did with each entry in the archive.
+type ImportResult struct {
+	Imported int
+	// Skipped counts entries that were incomplete or invalid, or older than the copy already in the cache.
+	Skipped int
+}
+
+// Export writes every entry in the cache directory dir to w as a gzipped tar archive, laid out like the
+// cache directory. It returns the number of entries written.
+func Export(dir string, w io.Writer) (int, error) {
+	var entries []Entry
+	if err := Entries(dir, func(entry Entry) error {
+		entries = append(entries, entry)
+		return nil
+	}); err != nil {
+		return 0, xerrors.Errorf("%w", err)
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].QueryKey < entries[j].QueryKey })
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	fileCacheMtx.RLock()
+	defer fileCacheMtx.RUnlock()
+
+	for i, entry := range entries {
+		fs := queryKeyToFSIn(dir, entry.QueryKey)
+		for _, filename := range []string{fs.MetadataFilename, fs.Filename} {
+			b, err := os.ReadFile(filename)
+			if err != nil {
+				return i, xerrors.Errorf("%w", err)
+			}
+
+			hdr := &tar.Header{
+				Name:    path.Join(entry.QueryKey[:2], path.Base(filename)),
+				Mode:    0644,
+				Size:    int64(len(b)),
+				ModTime: entry.FetchedAt,
+			}
+			if err := tw.WriteHeader(hdr); err != nil {
+				return i, xerrors.Errorf("%w", err)
+			}
+			if _, err := tw.Write(b); err != nil {
+				return i, xerrors.Errorf("%w", err)
+			}
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return len(entries), xerrors.Errorf("%w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return len(entries), xerrors.Errorf("%w", err)
+	}
+
+	return len(entries), nil
+}
+
+type archiveEntry struct {
+	metadata []byte
+	body     []byte
+}
+
+// Import adds the entries in an archive written by Export to the cache directory dir. An entry already in
+// the cache is only replaced by one fetched more recently. Export writes each entry's metadata and body
+// next to each other, so an entry is written as soon as both have been read and the archive is never
+// held in memory.
+func Import(dir string, r io.Reader) (ImportResult, error) {
+	var result ImportResult
+
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return result, xerrors.Errorf("%w", err)
+	}
+	defer gz.Close()
+
+	// pending holds the entries with only one of their files read so far
+	pending := make(map[string]*archiveEntry)
+	var pendingKeys []string
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return result, xerrors.Errorf("%w", err)
+		}
+		if hdr.Typeflag == tar.TypeDir {
+			continue
+		}
+
+		// only files laid out like the cache are accepted, so a name can't point outside dir
+		m := archiveName.FindStringSubmatch(hdr.Name)
+		if m == nil || m[1] != m[3] {
+			utils.Log(fmt.Sprintf("cache import: skipping %s: not a cache file", hdr.Name))
+			continue
+		}
+
+		b, err := io.ReadAll(tr)
+		if err != nil {
+			return result, xerrors.Errorf("%s: %w", hdr.Name, err)
+		}
+
+		key := m[2]
+		entry, ok := pending[key]
+		if !ok {
+			entry = &archiveEntry{}
+			pending[key] = entry
+			pendingKeys = append(pendingKeys, key)
+		}
+		if m[4] != "" {
+			entry.metadata = b
+		} else {
+			entry.body = b
+		}
+
+		if entry.metadata == nil || entry.body == nil {
+			continue
+		}
+		delete(pending, key)
+
+		fileCacheMtx.Lock()
+		imported, err := importEntry(dir, key, entry)
+		fileCacheMtx.Unlock()
+
+		switch {
+		case err != nil:
+			utils.Log(fmt.Sprintf("cache import: skipping %s: %s", key, err.Error()))
+			result.Skipped++
+		case !imported:
+			result.Skipped++
+		default:
+			result.Imported++
+		}
+	}
+
+	for _, key := range pendingKeys {
+		if _, ok := pending[key]; ok {
+			utils.Log(fmt.Sprintf("cache import: skipping %s: body or metadata missing", key))
+			result.Skipped++
+		}
+	}
+
+	return result, nil
+}
+
+// importEntry writes an archived entry to dir unless the cache already has one that's as recent.
+func importEntry(dir, key string, entry *archiveEntry) (bool, error) {
+	var md metadata
+	if err := json.Unmarshal(entry.metadata, &md); err != nil {
+		return false, xerrors.Errorf("%w", err)
+	}
+	query, err := url.ParseQuery(md.Query)
+	if err != nil {
+		return false, xerrors.Errorf("query: %w", err)
+	}
+	if md.QueryKey != key || getQueryKey(md.URL, query) != key {
+		return false, xerrors.Errorf("metadata doesn't hash to %s", key)
+	}
+
+	fs := queryKeyToFSIn(dir, key)
+
+	if b, err := os.ReadFile(fs.MetadataFilename); err == nil {
+		var existing metadata
+		if err := json.Unmarshal(b, &existing); err == nil && !existing.FetchedAt.Before(md.FetchedAt) {
+			return false, nil
+		}
+	}
+
+	if err := os.MkdirAll(fs.Dir, 0755); err != nil {
+		return false, xerrors.Errorf("%w", err)
+	}
+	if err := os.WriteFile(fs.Filename, entry.body, 0644); err != nil {
+		return false, xerrors.Errorf("%w", err)
+	}
+	if err := os.WriteFile(fs.MetadataFilename, entry.metadata, 0644); err != nil {
+		return false, xerrors.Errorf("%w", err)
+	}
+
+	return true, nil
+}
@@ -0,0 +1,148 @@
+package httpcache
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"automock/utils"
+)
+
+// Entry describes a response in a cache directory.
+type Entry struct {
+	URL       string
+	Query     url.Values
+	QueryKey  string
+	FetchedAt time.Time
+	Status    int
+	// Size is the size of the body and metadata files in bytes.
+	Size int64
+}
+
+// Source is the host and path the response was fetched from, e.g. explorer.lichess.ovh/masters.
+func (e Entry) Source() string {
+	u, err := url.Parse(e.URL)
+	if err != nil {
+		return e.URL
+	}
+	return u.Host + u.Path
+}
+
+// Host is the host the response was fetched from.
+func (e Entry) Host() string {
+	host, _, _ := strings.Cut(e.Source(), "/")
+	return host
+}
+
+// Entries calls fn for each entry in the cache directory dir. Legacy entries waiting for "cache migrate"
+// and metadata that can't be read are skipped.
+func Entries(dir string, fn func(entry Entry) error) error {
+	fileCacheMtx.RLock()
+	defer fileCacheMtx.RUnlock()
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(d.Name(), "-metadata.json") || isLegacyMetadataFile(d.Name()) {
+			return nil
+		}
+
+		entry, err := readEntry(dir, path)
+		if err != nil {
+			utils.Log(fmt.Sprintf("cache: skipping %s: %s", path, err.Error()))
+			return nil
+		}
+
+		return fn(entry)
+	})
+	if err != nil {
+		return xerrors.Errorf("%w", err)
+	}
+
+	return nil
+}
+
+func readEntry(dir, metadataFilename string) (Entry, error) {
+	b, err := os.ReadFile(metadataFilename)
+	if err != nil {
+		return Entry{}, xerrors.Errorf("%w", err)
+	}
+
+	var md metadata
+	if err := json.Unmarshal(b, &md); err != nil {
+		return Entry{}, xerrors.Errorf("%w", err)
+	}
+
+	query, err := url.ParseQuery(md.Query)
+	if err != nil {
+		return Entry{}, xerrors.Errorf("query: %w", err)
+	}
+	if md.QueryKey != getQueryKey(md.URL, query) {
+		return Entry{}, xerrors.Errorf("metadata doesn't hash to %s", md.QueryKey)
+	}
+
+	info, err := os.Stat(queryKeyToFSIn(dir, md.QueryKey).Filename)
+	if err != nil {
+		return Entry{}, xerrors.Errorf("%w", err)
+	}
+
+	return Entry{
+		URL:       md.URL,
+		Query:     query,
+		QueryKey:  md.QueryKey,
+		FetchedAt: md.FetchedAt,
+		Status:    md.Status,
+		Size:      info.Size() + int64(len(b)),
+	}, nil
+}
+
+// ReadBody returns the cached response body for entry.
+func ReadBody(dir string, entry Entry) ([]byte, error) {
+	fileCacheMtx.RLock()
+	defer fileCacheMtx.RUnlock()
+
+	b, err := os.ReadFile(queryKeyToFSIn(dir, entry.QueryKey).Filename)
+	if err != nil {
+		return nil, xerrors.Errorf("%w", err)
+	}
+	return b, nil
+}
+
+// Purge deletes the entries in dir whose source starts with source and that were fetched before before.
+// An empty source or zero before matches every entry. It returns the number of entries deleted.
+func Purge(dir, source string, before time.Time) (int, error) {
+	var entries []Entry
+	err := Entries(dir, func(entry Entry) error {
+		if strings.HasPrefix(entry.Source(), source) && (before.IsZero() || entry.FetchedAt.Before(before)) {
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, xerrors.Errorf("%w", err)
+	}
+
+	fileCacheMtx.Lock()
+	defer fileCacheMtx.Unlock()
+
+	for i, entry := range entries {
+		fs := queryKeyToFSIn(dir, entry.QueryKey)
+		// the metadata goes first so a failure part way never leaves metadata without a body
+		if err := os.Remove(fs.MetadataFilename); err != nil {
+			return i, xerrors.Errorf("%w", err)
+		}
+		if err := os.Remove(fs.Filename); err != nil && !os.IsNotExist(err) {
+			return i, xerrors.Errorf("%w", err)
+		}
+	}
+
+	return len(entries), nil
+}
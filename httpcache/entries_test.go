@@ -0,0 +1,182 @@
+package httpcache
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+// storeEntry writes an entry into the cache directory as if it had been fetched at fetchedAt.
+func storeEntry(t *testing.T, endpointURL, fen string, fetchedAt time.Time) string {
+	query := url.Values{"fen": {fen}}
+	queryKey := getQueryKey(endpointURL, query)
+
+	fs := queryKeyToFS(queryKey)
+	metadataBody, err := json.Marshal(metadata{URL: endpointURL, Query: query.Encode(), QueryKey: queryKey, FetchedAt: fetchedAt, Status: http.StatusOK})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(fs.Dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(fs.Filename, []byte(fmt.Sprintf(`{"fen":%q}`, fen)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(fs.MetadataFilename, metadataBody, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return queryKey
+}
+
+func listSources(t *testing.T, dir string) []string {
+	var sources []string
+	if err := Entries(dir, func(entry Entry) error {
+		sources = append(sources, entry.Source()+" "+entry.Query.Get("fen"))
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(sources)
+	return sources
+}
+
+func TestPurge(t *testing.T) {
+	now := time.Now()
+
+	cases := []struct {
+		name   string
+		source string
+		before time.Time
+		want   []string
+	}{
+		{name: "everything", want: nil},
+		{name: "by source", source: "explorer.lichess.ovh/masters", want: []string{"explorer.lichess.ovh/lichess a", "explorer.lichess.ovh/lichess b", "lichess.org/api/cloud-eval a"}},
+		{name: "by age", before: now.Add(-24 * time.Hour), want: []string{"explorer.lichess.ovh/lichess b", "explorer.lichess.ovh/masters a"}},
+		{name: "by source and age", source: "explorer.lichess.ovh/", before: now.Add(-24 * time.Hour), want: []string{"explorer.lichess.ovh/lichess b", "explorer.lichess.ovh/masters a", "lichess.org/api/cloud-eval a"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// arrange
+			dir := useTempCache(t)
+			storeEntry(t, "https://explorer.lichess.ovh/lichess", "a", now.Add(-48*time.Hour))
+			storeEntry(t, "https://explorer.lichess.ovh/lichess", "b", now)
+			storeEntry(t, "https://explorer.lichess.ovh/masters", "a", now)
+			storeEntry(t, "https://lichess.org/api/cloud-eval", "a", now.Add(-48*time.Hour))
+
+			// act
+			_, err := Purge(dir, c.source, c.before)
+
+			// assert
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := listSources(t, dir); fmt.Sprint(c.want) != fmt.Sprint(got) {
+				t.Errorf("want: %q got: %q", c.want, got)
+			}
+		})
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	// arrange
+	now := time.Now().Truncate(time.Second)
+
+	src := useTempCache(t)
+	storeEntry(t, "https://explorer.lichess.ovh/lichess", "a", now.Add(-time.Hour))
+	storeEntry(t, "https://lichess.org/api/cloud-eval", "a", now.Add(-time.Hour))
+	staleKey := storeEntry(t, "https://explorer.lichess.ovh/masters", "a", now.Add(-time.Hour))
+
+	var archive bytes.Buffer
+	n, err := Export(src, &archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Errorf("exported want: 3 got: %d", n)
+	}
+
+	dst := useTempCache(t)
+	// the destination already has a newer copy of one entry
+	storeEntry(t, "https://explorer.lichess.ovh/masters", "a", now)
+
+	// act
+	result, err := Import(dst, bytes.NewReader(archive.Bytes()))
+
+	// assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Imported != 2 || result.Skipped != 1 {
+		t.Errorf("want: imported 2 skipped 1 got: %+v", result)
+	}
+
+	want := listSources(t, src)
+	if got := listSources(t, dst); fmt.Sprint(want) != fmt.Sprint(got) {
+		t.Errorf("want: %q got: %q", want, got)
+	}
+
+	var fetchedAt time.Time
+	_ = Entries(dst, func(entry Entry) error {
+		if entry.QueryKey == staleKey {
+			fetchedAt = entry.FetchedAt
+		}
+		return nil
+	})
+	if !fetchedAt.Equal(now) {
+		t.Errorf("newer entry replaced, fetched at want: %s got: %s", now, fetchedAt)
+	}
+
+	if _, err := os.Stat(filepath.Join(dst, staleKey[:2], staleKey+".json")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestImport_MissingHalf(t *testing.T) {
+	// arrange
+	src := useTempCache(t)
+	key := storeEntry(t, "https://explorer.lichess.ovh/lichess", "a", time.Now())
+	metadata, err := os.ReadFile(filepath.Join(src, key[:2], key+"-metadata.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// an archive with the metadata and no body
+	var archive bytes.Buffer
+	gz := gzip.NewWriter(&archive)
+	tw := tar.NewWriter(gz)
+	if err := tw.WriteHeader(&tar.Header{Name: key[:2] + "/" + key + "-metadata.json", Mode: 0644, Size: int64(len(metadata))}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write(metadata); err != nil {
+		t.Fatal(err)
+	}
+	tw.Close()
+	gz.Close()
+
+	dst := useTempCache(t)
+
+	// act
+	result, err := Import(dst, &archive)
+
+	// assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Imported != 0 || result.Skipped != 1 {
+		t.Errorf("want: imported 0 skipped 1 got: %+v", result)
+	}
+	if _, err := os.Stat(filepath.Join(dst, key[:2], key+"-metadata.json")); !os.IsNotExist(err) {
+		t.Errorf("want nothing written, got: %v", err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/sha1"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
@@ -13,6 +14,7 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"golang.org/x/xerrors"
 
@@ -20,62 +22,194 @@ import (
 	"automock/utils"
 )
 
-const cacheDir = "./cache"
-
 var (
-	cache        = make(map[string][]byte)
+	cacheDir = "./cache"
+
+	cache        = make(map[string]cachedResponse)
 	memCacheMtx  sync.RWMutex
 	fileCacheMtx sync.RWMutex
+
+	// refreshing holds the query keys being revalidated in the background
+	refreshing    = make(map[string]bool)
+	refreshingMtx sync.Mutex
 )
 
-func Get(ctx context.Context, skipCache bool, url string, query url.Values, header http.Header) ([]byte, bool, error) {
+const backgroundRefreshTimeout = 30 * time.Second
+
+type cachedResponse struct {
+	body      []byte
+	fetchedAt time.Time
+}
+
+// SetCacheDir sets the directory responses are cached in. It should be called before the first Get.
+func SetCacheDir(dir string) {
+	cacheDir = dir
+}
+
+// Get returns the response body for url and query, from the cache if policy allows it. The bool reports
+// whether the body came from the cache. In offline mode the network is never used.
+func Get(ctx context.Context, policy Policy, url string, query url.Values, header http.Header) ([]byte, bool, error) {
 	queryKey := getQueryKey(url, query)
+	queryString := query.Encode()
+
+	cached, ok := getCachedResponse(queryKey, url, queryString)
 
-	if !skipCache {
-		cachedResponse := getCachedResponse(queryKey)
-		if cachedResponse != nil {
-			return cachedResponse, true, nil
+	if Offline() {
+		if ok {
+			return cached.body, true, nil
 		}
+		return nil, false, xerrors.Errorf("GET %s: %w", url, ErrNotCached)
 	}
 
+	if ok {
+		switch policy.state(cached, time.Now()) {
+		case fresh:
+			return cached.body, true, nil
+		case stale:
+			if policy.StaleWhileRevalidate {
+				refreshInBackground(queryKey, url, query, header, policy.OnFetch)
+				return cached.body, true, nil
+			}
+		}
+	}
+
+	body, err := fetchShared(ctx, queryKey, url, query, header, policy.OnFetch)
+	if err != nil {
+		if ok && policy.StaleIfError {
+			utils.Log(fmt.Sprintf("HTTP Error: serving stale response fetched %s: %s", cached.fetchedAt.Format(time.RFC3339), err.Error()))
+			return cached.body, true, nil
+		}
+		return nil, false, err
+	}
+
+	return body, false, nil
+}
+
+// FetchedAt returns when the response Get last returned for url and query was fetched.
+func FetchedAt(url string, query url.Values) (time.Time, bool) {
+	memCacheMtx.RLock()
+	cached, ok := cache[getQueryKey(url, query)]
+	memCacheMtx.RUnlock()
+
+	return cached.fetchedAt, ok
+}
+
+// refreshInBackground fetches the response again without making the caller wait. Only one refresh per
+// query key runs at a time.
+func refreshInBackground(queryKey, url string, query url.Values, header http.Header, onFetch func([]byte, time.Time)) {
+	refreshingMtx.Lock()
+	if refreshing[queryKey] {
+		refreshingMtx.Unlock()
+		return
+	}
+	refreshing[queryKey] = true
+	refreshingMtx.Unlock()
+
+	go func() {
+		defer func() {
+			refreshingMtx.Lock()
+			delete(refreshing, queryKey)
+			refreshingMtx.Unlock()
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), backgroundRefreshTimeout)
+		defer cancel()
+
+		if _, err := fetchShared(ctx, queryKey, url, query, header, onFetch); err != nil {
+			utils.Log(fmt.Sprintf("HTTP Error: background refresh: %s", err.Error()))
+		}
+	}()
+}
+
+// client is shared so connections to each host are reused.
+var client = &http.Client{
+	Timeout:   30 * time.Second,
+	Transport: newTransport(),
+}
+
+func newTransport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.MaxIdleConnsPerHost = 8
+	return t
+}
+
+// fetch requests the url through the host's rate limiter, retries 429 and 5xx responses, and caches a
+// 200 response. It returns when the cached response was fetched.
+func fetch(ctx context.Context, queryKey, endpointURL string, query url.Values, header http.Header) ([]byte, time.Time, error) {
+	url := endpointURL
 	queryString := query.Encode()
 	if queryString != "" {
 		url += "?" + queryString
 	}
 
-	utils.Log(fmt.Sprintf("HTTP Request: GET %s", url))
-
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		return nil, false, xerrors.Errorf("failed to create request: %w", err)
+		return nil, time.Time{}, xerrors.Errorf("failed to create request: %w", err)
 	}
 
 	for k, v := range header {
 		req.Header.Set(k, v[0])
 	}
 
-	var c http.Client
+	limiter := hostLimiter(req.URL.Host)
 
-	resp, err := c.Do(req)
-	if err != nil {
-		return nil, false, xerrors.Errorf("GET %s: %w", url, err)
-	}
-	defer resp.Body.Close()
+	for attempt := 0; ; attempt++ {
+		if err := limiter.wait(ctx); err != nil {
+			return nil, time.Time{}, xerrors.Errorf("GET %s: waiting for rate limit: %w", url, err)
+		}
 
-	responseBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, false, xerrors.Errorf("GET %s, error reading body: %w", url, err)
-	}
+		utils.Log(fmt.Sprintf("HTTP Request: GET %s", url))
 
-	utils.Log(fmt.Sprintf("HTTP Response: GET %s returned HTTP %s %s bytes", url, resp.Status, commas.Int(len(responseBody))))
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, time.Time{}, xerrors.Errorf("GET %s: %w", url, err)
+		}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, false, xerrors.Errorf("unexpected status code: %s response body: %s", resp.Status, string(responseBody))
-	}
+		responseBody, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, time.Time{}, xerrors.Errorf("GET %s, error reading body: %w", url, err)
+		}
+
+		utils.Log(fmt.Sprintf("HTTP Response: GET %s returned HTTP %s %s bytes", url, resp.Status, commas.Int(len(responseBody))))
+
+		if resp.StatusCode == http.StatusOK {
+			fetchedAt := storeCachedResponse(queryKey, endpointURL, queryString, resp.StatusCode, responseBody)
+			return responseBody, fetchedAt, nil
+		}
+
+		statusErr := xerrors.Errorf("unexpected status code: %s response body: %s", resp.Status, string(responseBody))
+		if !retryable(resp.StatusCode) {
+			return nil, time.Time{}, statusErr
+		}
+
+		// the limiter makes everyone wait out a 429, not just this request, so it's blocked even when
+		// this was the last attempt
+		delay := backoff(attempt)
+		if until, ok := retryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+			limiter.block(until)
+			delay = 0
+		} else if resp.StatusCode == http.StatusTooManyRequests {
+			limiter.block(time.Now().Add(tooManyRequestsDelay))
+			delay = 0
+		}
+
+		if attempt == maxRetries {
+			return nil, time.Time{}, statusErr
+		}
 
-	storeCachedResponse(queryKey, url, query.Encode(), responseBody)
+		utils.Log(fmt.Sprintf("HTTP Retry: GET %s returned HTTP %s, retry %d of %d", url, resp.Status, attempt+1, maxRetries))
 
-	return responseBody, false, nil
+		if delay > 0 {
+			timer := time.NewTimer(delay)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, time.Time{}, xerrors.Errorf("GET %s: %w", url, ctx.Err())
+			case <-timer.C:
+			}
+		}
+	}
 }
 
 func getQueryKey(url string, query url.Values) string {
@@ -97,29 +231,52 @@ func getQueryKey(url string, query url.Values) string {
 	return hex.EncodeToString(h.Sum(nil))
 }
 
-func getCachedResponse(queryKey string) []byte {
+// metadata is stored next to each cached body. The url and query are checked on lookup so a cached
+// body is only returned for the request it was fetched for.
+type metadata struct {
+	URL       string    `json:"url"`
+	Query     string    `json:"query"`
+	QueryKey  string    `json:"query_key"`
+	FetchedAt time.Time `json:"fetched_at"`
+	Status    int       `json:"status"`
+}
+
+func getCachedResponse(queryKey, url, query string) (cachedResponse, bool) {
 	memCacheMtx.RLock()
-	cachedResponse, ok := cache[queryKey]
+	cached, ok := cache[queryKey]
 	memCacheMtx.RUnlock()
 
 	if ok {
-		return cachedResponse
+		return cached, true
 	}
 
 	fs := queryKeyToFS(queryKey)
 
 	fileCacheMtx.RLock()
+	metadataBody, metadataErr := os.ReadFile(fs.MetadataFilename)
 	b, err := os.ReadFile(fs.Filename)
 	fileCacheMtx.RUnlock()
-	if err != nil {
-		return nil
+	if metadataErr != nil || err != nil {
+		return cachedResponse{}, false
 	}
 
+	var md metadata
+	if err := json.Unmarshal(metadataBody, &md); err != nil {
+		utils.Log(fmt.Sprintf("cache: %s: %s", fs.MetadataFilename, err.Error()))
+		return cachedResponse{}, false
+	}
+	if md.URL != url || md.Query != query {
+		utils.Log(fmt.Sprintf("cache: %s: metadata doesn't match url=%s query=%s", fs.MetadataFilename, url, query))
+		return cachedResponse{}, false
+	}
+
+	cached = cachedResponse{body: b, fetchedAt: md.FetchedAt}
+
 	memCacheMtx.Lock()
-	cache[queryKey] = b
+	cache[queryKey] = cached
 	memCacheMtx.Unlock()
 
-	return b
+	return cached, true
 }
 
 type queryKeyFileSystem struct {
@@ -129,34 +286,51 @@ type queryKeyFileSystem struct {
 }
 
 func queryKeyToFS(queryKey string) queryKeyFileSystem {
+	return queryKeyToFSIn(cacheDir, queryKey)
+}
+
+func queryKeyToFSIn(cacheDir, queryKey string) queryKeyFileSystem {
 	prefix := queryKey[:2]
 	dir := filepath.Join(cacheDir, prefix)
 
 	return queryKeyFileSystem{
 		Dir:              dir,
-		Filename:         filepath.Join(dir, queryKey[:8]+".json"),
-		MetadataFilename: filepath.Join(dir, queryKey[:8]+"-metadata.json"),
+		Filename:         filepath.Join(dir, queryKey+".json"),
+		MetadataFilename: filepath.Join(dir, queryKey+"-metadata.json"),
 	}
 }
 
-func storeCachedResponse(queryKey, url, query string, body []byte) {
+func storeCachedResponse(queryKey, url, query string, status int, body []byte) time.Time {
+	fetchedAt := time.Now().UTC()
+
 	memCacheMtx.Lock()
-	cache[queryKey] = body
+	cache[queryKey] = cachedResponse{body: body, fetchedAt: fetchedAt}
 	memCacheMtx.Unlock()
 
 	fs := queryKeyToFS(queryKey)
-	metadataBody := []byte(fmt.Sprintf("url=%s\nquery=%s\nqueryKey=%s\n", url, query, queryKey))
+	metadataBody, err := json.Marshal(metadata{
+		URL:       url,
+		Query:     query,
+		QueryKey:  queryKey,
+		FetchedAt: fetchedAt,
+		Status:    status,
+	})
+	if err != nil {
+		return fetchedAt
+	}
 
 	fileCacheMtx.Lock()
 	defer fileCacheMtx.Unlock()
 
 	if err := os.MkdirAll(fs.Dir, 0755); err != nil {
-		return
+		return fetchedAt
 	}
 	if err := os.WriteFile(fs.Filename, body, 0644); err != nil {
-		return
+		return fetchedAt
 	}
 	if err := os.WriteFile(fs.MetadataFilename, metadataBody, 0644); err != nil {
-		return
+		return fetchedAt
 	}
+
+	return fetchedAt
 }
@@ -0,0 +1,174 @@
+package httpcache
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	retryBaseDelay = time.Millisecond
+	os.Exit(m.Run())
+}
+
+// useTempCache points the cache at an empty directory and clears the memory cache.
+func useTempCache(t *testing.T) string {
+	waitForFetches()
+
+	dir := t.TempDir()
+	SetCacheDir(dir)
+
+	resetMemCache()
+
+	return dir
+}
+
+// waitForFetches waits for background refreshes and shared fetches left over from an earlier test, which
+// would otherwise write to that test's cache directory.
+func waitForFetches() {
+	for {
+		refreshingMtx.Lock()
+		n := len(refreshing)
+		refreshingMtx.Unlock()
+
+		inflightMtx.Lock()
+		n += len(inflight)
+		inflightMtx.Unlock()
+
+		if n == 0 {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func resetMemCache() {
+	memCacheMtx.Lock()
+	cache = make(map[string]cachedResponse)
+	memCacheMtx.Unlock()
+}
+
+func TestGet_Cache(t *testing.T) {
+	// arrange
+	useTempCache(t)
+
+	var requests int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		fmt.Fprintf(w, `{"fen":"%s"}`, r.URL.Query().Get("fen"))
+	}))
+	defer server.Close()
+
+	query := url.Values{"fen": {"a"}}
+
+	// act
+	first, firstHit, err := Get(context.Background(), Policy{}, server.URL, query, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// drop the memory cache so the second Get reads the files
+	resetMemCache()
+
+	second, secondHit, err := Get(context.Background(), Policy{}, server.URL, query, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// assert
+	if firstHit || !secondHit {
+		t.Errorf("cache hits want: false, true got: %v, %v", firstHit, secondHit)
+	}
+	if string(first) != string(second) || string(first) != `{"fen":"a"}` {
+		t.Errorf("want: %s got: %s, %s", `{"fen":"a"}`, first, second)
+	}
+	if n := atomic.LoadInt64(&requests); n != 1 {
+		t.Errorf("requests want: 1 got: %d", n)
+	}
+}
+
+func TestGet_MetadataMismatch(t *testing.T) {
+	// arrange
+	useTempCache(t)
+
+	var requests int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		fmt.Fprintf(w, `{"fen":"%s"}`, r.URL.Query().Get("fen"))
+	}))
+	defer server.Close()
+
+	query := url.Values{"fen": {"a"}}
+	queryKey := getQueryKey(server.URL, query)
+
+	// a body stored under this key for a different request, as a collision would leave it
+	storeCachedResponse(queryKey, server.URL, url.Values{"fen": {"b"}}.Encode(), http.StatusOK, []byte(`{"fen":"b"}`))
+	resetMemCache()
+
+	// act
+	got, cacheHit, err := Get(context.Background(), Policy{}, server.URL, query, nil)
+
+	// assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cacheHit {
+		t.Errorf("want cache miss")
+	}
+	if string(got) != `{"fen":"a"}` {
+		t.Errorf("want: %s got: %s", `{"fen":"a"}`, got)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	// arrange
+	dir := useTempCache(t)
+
+	const endpointURL = "https://explorer.lichess.ovh/lichess"
+	query := url.Values{"fen": {"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"}, "moves": {"20"}}
+	queryKey := getQueryKey(endpointURL, query)
+
+	legacyDir := filepath.Join(dir, queryKey[:2])
+	if err := os.MkdirAll(legacyDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	legacyMetadata := fmt.Sprintf("url=%s?%s\nquery=%s\nqueryKey=%s\n", endpointURL, query.Encode(), query.Encode(), queryKey)
+	files := map[string]string{
+		queryKey[:8] + ".json":          `{"white":1}`,
+		queryKey[:8] + "-metadata.json": legacyMetadata,
+		// metadata that doesn't hash to its name is left alone
+		"0badc0de.json":          `{}`,
+		"0badc0de-metadata.json": legacyMetadata,
+	}
+	for name, body := range files {
+		if err := os.WriteFile(filepath.Join(legacyDir, name), []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// act
+	result, err := Migrate(dir)
+
+	// assert
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Migrated != 1 || result.Skipped != 1 {
+		t.Errorf("want: migrated 1 skipped 1 got: %+v", result)
+	}
+	if _, err := os.Stat(filepath.Join(legacyDir, queryKey[:8]+".json")); !os.IsNotExist(err) {
+		t.Errorf("want legacy body removed, got: %v", err)
+	}
+
+	got, _ := getCachedResponse(queryKey, endpointURL, query.Encode())
+	if string(got.body) != `{"white":1}` {
+		t.Errorf("want: %s got: %s", `{"white":1}`, got.body)
+	}
+}
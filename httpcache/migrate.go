@@ -0,0 +1,144 @@
+package httpcache
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"automock/utils"
+)
+
+// MigrateResult counts what Migrate did with each legacy entry.
+type MigrateResult struct {
+	Migrated int
+	Skipped  int
+}
+
+// Migrate re-keys a cache written before full-hash filenames. Legacy entries are named after the first 8
+// hex digits of the query key, with a text metadata file of url=, query= and queryKey= lines. Each one is
+// rewritten under its full key with JSON metadata, using the body file's modification time as the fetch
+// time. Entries whose metadata can't be read, or doesn't hash to the key in its name, are skipped and
+// left in place.
+func Migrate(dir string) (MigrateResult, error) {
+	var result MigrateResult
+
+	fileCacheMtx.Lock()
+	defer fileCacheMtx.Unlock()
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !isLegacyMetadataFile(d.Name()) {
+			return nil
+		}
+
+		if err := migrateEntry(dir, path); err != nil {
+			utils.Log(fmt.Sprintf("cache migrate: skipping %s: %s", path, err.Error()))
+			result.Skipped++
+			return nil
+		}
+		result.Migrated++
+
+		return nil
+	})
+	if err != nil {
+		return result, xerrors.Errorf("%w", err)
+	}
+
+	return result, nil
+}
+
+// isLegacyMetadataFile matches xxxxxxxx-metadata.json, where x is a hex digit.
+func isLegacyMetadataFile(name string) bool {
+	key := strings.TrimSuffix(name, "-metadata.json")
+	if len(key) != 8 || key == name {
+		return false
+	}
+	for _, c := range key {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return false
+		}
+	}
+	return true
+}
+
+func migrateEntry(dir, metadataFilename string) error {
+	legacyKey := strings.TrimSuffix(filepath.Base(metadataFilename), "-metadata.json")
+	bodyFilename := filepath.Join(filepath.Dir(metadataFilename), legacyKey+".json")
+
+	b, err := os.ReadFile(metadataFilename)
+	if err != nil {
+		return xerrors.Errorf("%w", err)
+	}
+
+	fields := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		name, value, ok := strings.Cut(scanner.Text(), "=")
+		if ok {
+			fields[name] = value
+		}
+	}
+
+	// the legacy url= line has the query string appended
+	endpointURL, _, _ := strings.Cut(fields["url"], "?")
+	query, err := url.ParseQuery(fields["query"])
+	if err != nil {
+		return xerrors.Errorf("query: %w", err)
+	}
+
+	queryKey := getQueryKey(endpointURL, query)
+	if !strings.HasPrefix(queryKey, legacyKey) || (fields["queryKey"] != "" && fields["queryKey"] != queryKey) {
+		return xerrors.Errorf("metadata hashes to %s", queryKey)
+	}
+
+	info, err := os.Stat(bodyFilename)
+	if err != nil {
+		return xerrors.Errorf("%w", err)
+	}
+	body, err := os.ReadFile(bodyFilename)
+	if err != nil {
+		return xerrors.Errorf("%w", err)
+	}
+
+	metadataBody, err := json.Marshal(metadata{
+		URL:       endpointURL,
+		Query:     query.Encode(),
+		QueryKey:  queryKey,
+		FetchedAt: info.ModTime().UTC().Truncate(time.Second),
+		Status:    200,
+	})
+	if err != nil {
+		return xerrors.Errorf("%w", err)
+	}
+
+	fs := queryKeyToFSIn(dir, queryKey)
+	if err := os.MkdirAll(fs.Dir, 0755); err != nil {
+		return xerrors.Errorf("%w", err)
+	}
+	if err := os.WriteFile(fs.Filename, body, 0644); err != nil {
+		return xerrors.Errorf("%w", err)
+	}
+	if err := os.WriteFile(fs.MetadataFilename, metadataBody, 0644); err != nil {
+		return xerrors.Errorf("%w", err)
+	}
+
+	if err := os.Remove(bodyFilename); err != nil {
+		return xerrors.Errorf("%w", err)
+	}
+	if err := os.Remove(metadataFilename); err != nil {
+		return xerrors.Errorf("%w", err)
+	}
+
+	return nil
+}
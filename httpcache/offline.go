@@ -0,0 +1,27 @@
+package httpcache
+
+import (
+	"sync/atomic"
+
+	"golang.org/x/xerrors"
+)
+
+// ErrNotCached is returned by Get in offline mode when the response isn't in the cache.
+var ErrNotCached = xerrors.New("not cached")
+
+var offline int32
+
+// SetOffline stops Get going to the network. Cached responses are returned however old they are, and
+// anything else fails with ErrNotCached.
+func SetOffline(on bool) {
+	var n int32
+	if on {
+		n = 1
+	}
+	atomic.StoreInt32(&offline, n)
+}
+
+// Offline reports whether Get is in offline mode.
+func Offline() bool {
+	return atomic.LoadInt32(&offline) == 1
+}
@@ -0,0 +1,69 @@
+package httpcache
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGet_Offline(t *testing.T) {
+	cases := []struct {
+		name         string
+		cachedBody   string
+		cachedAge    time.Duration
+		want         string
+		wantCacheHit bool
+		wantErr      error
+	}{
+		{name: "fresh", cachedBody: "cached", cachedAge: time.Minute, want: "cached", wantCacheHit: true},
+		{name: "stale is served", cachedBody: "cached", cachedAge: 365 * 24 * time.Hour, want: "cached", wantCacheHit: true},
+		{name: "not cached", wantErr: ErrNotCached},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// arrange
+			useTempCache(t)
+
+			SetOffline(true)
+			defer SetOffline(false)
+
+			var requests int64
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt64(&requests, 1)
+				w.Write([]byte("fetched"))
+			}))
+			defer server.Close()
+
+			query := url.Values{"fen": {"a"}}
+
+			if c.cachedBody != "" {
+				memCacheMtx.Lock()
+				cache[getQueryKey(server.URL, query)] = cachedResponse{body: []byte(c.cachedBody), fetchedAt: time.Now().Add(-c.cachedAge)}
+				memCacheMtx.Unlock()
+			}
+
+			// act
+			got, cacheHit, err := Get(context.Background(), Policy{TTL: time.Hour, StaleWhileRevalidate: true}, server.URL, query, nil)
+
+			// assert
+			if !errors.Is(err, c.wantErr) {
+				t.Errorf("wantErr: %v got: %v", c.wantErr, err)
+			}
+			if c.want != string(got) {
+				t.Errorf("want: %q got: %q", c.want, got)
+			}
+			if c.wantCacheHit != cacheHit {
+				t.Errorf("cacheHit want: %v got: %v", c.wantCacheHit, cacheHit)
+			}
+			if n := atomic.LoadInt64(&requests); n != 0 {
+				t.Errorf("requests want: 0 got: %d", n)
+			}
+		})
+	}
+}
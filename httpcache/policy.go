@@ -0,0 +1,41 @@
+package httpcache
+
+import (
+	"time"
+)
+
+// Policy says how long a cached response can be served, and what to do once it's older than that.
+type Policy struct {
+	// TTL is how long a response is fresh. 0 keeps it fresh forever.
+	TTL time.Duration
+	// StaleWhileRevalidate serves a stale response immediately and fetches a new one in the background.
+	StaleWhileRevalidate bool
+	// StaleIfError serves a stale response if fetching a new one fails.
+	StaleIfError bool
+	// Empty, if set, reports whether a response has no data, e.g. a position nobody has played yet. An
+	// empty response is always stale and is fetched again before being served.
+	Empty func(body []byte) bool
+	// OnFetch, if set, is called with each response fetched from the network for the request, including
+	// one fetched by a background refresh after Get has returned.
+	OnFetch func(body []byte, fetchedAt time.Time)
+}
+
+type cacheState int
+
+const (
+	fresh cacheState = iota
+	stale
+	// emptyStale is a stale empty response. It isn't served while revalidating, there's a fair chance
+	// the new response has data.
+	emptyStale
+)
+
+func (p Policy) state(cached cachedResponse, now time.Time) cacheState {
+	if p.Empty != nil && p.Empty(cached.body) {
+		return emptyStale
+	}
+	if p.TTL != 0 && now.Sub(cached.fetchedAt) > p.TTL {
+		return stale
+	}
+	return fresh
+}
@@ -0,0 +1,151 @@
+package httpcache
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGet_Policy(t *testing.T) {
+	const ttl = time.Hour
+
+	isEmpty := func(b []byte) bool { return string(b) == "empty" }
+
+	cases := []struct {
+		name         string
+		policy       Policy
+		cachedBody   string
+		cachedAge    time.Duration
+		serverDown   bool
+		want         string
+		wantCacheHit bool
+		wantErr      bool
+		wantRequests int64
+	}{
+		{
+			name:         "fresh",
+			policy:       Policy{TTL: ttl},
+			cachedBody:   "cached",
+			cachedAge:    time.Minute,
+			want:         "cached",
+			wantCacheHit: true,
+			wantRequests: 0,
+		},
+		{
+			name:         "no ttl is fresh forever",
+			policy:       Policy{},
+			cachedBody:   "cached",
+			cachedAge:    365 * 24 * time.Hour,
+			want:         "cached",
+			wantCacheHit: true,
+			wantRequests: 0,
+		},
+		{
+			name:         "stale is fetched",
+			policy:       Policy{TTL: ttl},
+			cachedBody:   "cached",
+			cachedAge:    2 * ttl,
+			want:         "fetched",
+			wantRequests: 1,
+		},
+		{
+			name:         "stale while revalidate",
+			policy:       Policy{TTL: ttl, StaleWhileRevalidate: true},
+			cachedBody:   "cached",
+			cachedAge:    2 * ttl,
+			want:         "cached",
+			wantCacheHit: true,
+			wantRequests: 1,
+		},
+		{
+			name:         "stale if error",
+			policy:       Policy{TTL: ttl, StaleIfError: true},
+			cachedBody:   "cached",
+			cachedAge:    2 * ttl,
+			serverDown:   true,
+			want:         "cached",
+			wantCacheHit: true,
+			wantRequests: 1 + maxRetries,
+		},
+		{
+			name:         "stale error",
+			policy:       Policy{TTL: ttl},
+			cachedBody:   "cached",
+			cachedAge:    2 * ttl,
+			serverDown:   true,
+			wantErr:      true,
+			wantRequests: 1 + maxRetries,
+		},
+		{
+			name:         "empty is fetched even while revalidating",
+			policy:       Policy{TTL: ttl, StaleWhileRevalidate: true, Empty: isEmpty},
+			cachedBody:   "empty",
+			cachedAge:    time.Minute,
+			want:         "fetched",
+			wantRequests: 1,
+		},
+		{
+			name:         "empty if error",
+			policy:       Policy{TTL: ttl, StaleIfError: true, Empty: isEmpty},
+			cachedBody:   "empty",
+			cachedAge:    time.Minute,
+			serverDown:   true,
+			want:         "empty",
+			wantCacheHit: true,
+			wantRequests: 1 + maxRetries,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// arrange
+			useTempCache(t)
+
+			var requests int64
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt64(&requests, 1)
+				if c.serverDown {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				fmt.Fprint(w, "fetched")
+			}))
+			defer server.Close()
+
+			query := url.Values{"fen": {"a"}}
+			queryKey := getQueryKey(server.URL, query)
+
+			memCacheMtx.Lock()
+			cache[queryKey] = cachedResponse{body: []byte(c.cachedBody), fetchedAt: time.Now().Add(-c.cachedAge)}
+			memCacheMtx.Unlock()
+
+			// act
+			got, cacheHit, err := Get(context.Background(), c.policy, server.URL, query, nil)
+
+			// assert
+			if (err != nil) != c.wantErr {
+				t.Fatalf("wantErr: %v got: %v", c.wantErr, err)
+			}
+			if c.want != string(got) {
+				t.Errorf("want: %q got: %q", c.want, got)
+			}
+			if c.wantCacheHit != cacheHit {
+				t.Errorf("cacheHit want: %v got: %v", c.wantCacheHit, cacheHit)
+			}
+
+			// the background refresh is asynchronous
+			deadline := time.Now().Add(time.Second)
+			for atomic.LoadInt64(&requests) < c.wantRequests && time.Now().Before(deadline) {
+				time.Sleep(5 * time.Millisecond)
+			}
+			if n := atomic.LoadInt64(&requests); c.wantRequests != n {
+				t.Errorf("requests want: %d got: %d", c.wantRequests, n)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package httpcache
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRatePerSecond = 2
+	defaultBurst         = 4
+)
+
+var (
+	limiters    = make(map[string]*limiter)
+	limitersMtx sync.Mutex
+
+	// rateLimits overrides the default rate for a host
+	rateLimits = make(map[string]rateLimit)
+)
+
+type rateLimit struct {
+	perSecond float64
+	burst     int
+}
+
+// limiter is a token bucket. A request takes a token; tokens refill at perSecond up to burst. A 429
+// response blocks the host until its Retry-After has passed, or for tooManyRequestsDelay without one.
+type limiter struct {
+	mtx          sync.Mutex
+	perSecond    float64
+	burst        float64
+	tokens       float64
+	last         time.Time
+	blockedUntil time.Time
+}
+
+// SetRateLimit sets the request rate for host, e.g. explorer.lichess.ovh. It should be called before the
+// first Get.
+func SetRateLimit(host string, perSecond float64, burst int) {
+	limitersMtx.Lock()
+	defer limitersMtx.Unlock()
+
+	rateLimits[host] = rateLimit{perSecond: perSecond, burst: burst}
+	delete(limiters, host)
+}
+
+func hostLimiter(host string) *limiter {
+	limitersMtx.Lock()
+	defer limitersMtx.Unlock()
+
+	l, ok := limiters[host]
+	if !ok {
+		rl, ok := rateLimits[host]
+		if !ok {
+			rl = rateLimit{perSecond: defaultRatePerSecond, burst: defaultBurst}
+		}
+		l = &limiter{perSecond: rl.perSecond, burst: float64(rl.burst), tokens: float64(rl.burst), last: time.Now()}
+		limiters[host] = l
+	}
+	return l
+}
+
+// wait blocks until a token is available or ctx is done.
+func (l *limiter) wait(ctx context.Context) error {
+	for {
+		delay := l.reserve(time.Now())
+		if delay == 0 {
+			return nil
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// reserve takes a token and returns 0, or returns how long to wait before trying again.
+func (l *limiter) reserve(now time.Time) time.Duration {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	if now.Before(l.blockedUntil) {
+		return l.blockedUntil.Sub(now)
+	}
+
+	l.refill(now)
+
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0
+	}
+
+	return time.Duration((1 - l.tokens) / l.perSecond * float64(time.Second))
+}
+
+func (l *limiter) refill(now time.Time) {
+	if elapsed := now.Sub(l.last).Seconds(); elapsed > 0 {
+		l.tokens += elapsed * l.perSecond
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+	l.last = now
+}
+
+// block stops requests to the host until t.
+func (l *limiter) block(t time.Time) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	if t.After(l.blockedUntil) {
+		l.blockedUntil = t
+	}
+}
+
+// LimiterState is a snapshot of a host's rate limiter.
+type LimiterState struct {
+	Host         string
+	PerSecond    float64
+	Burst        int
+	Tokens       float64
+	BlockedUntil time.Time
+}
+
+// LimiterStates returns the state of the limiter of each host that has been requested, sorted by host.
+func LimiterStates() []LimiterState {
+	limitersMtx.Lock()
+	hosts := make([]string, 0, len(limiters))
+	for host := range limiters {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	states := make([]LimiterState, 0, len(hosts))
+	for _, host := range hosts {
+		l := limiters[host]
+
+		l.mtx.Lock()
+		l.refill(time.Now())
+		state := LimiterState{
+			Host:      host,
+			PerSecond: l.perSecond,
+			Burst:     int(l.burst),
+			Tokens:    l.tokens,
+		}
+		if time.Now().Before(l.blockedUntil) {
+			state.BlockedUntil = l.blockedUntil
+		}
+		l.mtx.Unlock()
+
+		states = append(states, state)
+	}
+	limitersMtx.Unlock()
+
+	return states
+}
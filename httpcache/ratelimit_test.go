@@ -0,0 +1,248 @@
+package httpcache
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGet_Retry(t *testing.T) {
+	cases := []struct {
+		name         string
+		statuses     []int
+		retryAfter   string
+		want         string
+		wantErr      bool
+		wantRequests int64
+		minDuration  time.Duration
+	}{
+		{name: "ok", statuses: []int{200}, want: "ok", wantRequests: 1},
+		{name: "5xx then ok", statuses: []int{503, 502, 200}, want: "ok", wantRequests: 3},
+		{name: "429 then ok", statuses: []int{429, 200}, want: "ok", wantRequests: 2, minDuration: 200 * time.Millisecond},
+		{name: "429 retry after", statuses: []int{429, 200}, retryAfter: "1", want: "ok", wantRequests: 2, minDuration: time.Second},
+		{name: "too many 5xx", statuses: []int{500, 500, 500, 500, 200}, wantErr: true, wantRequests: 1 + maxRetries},
+		{name: "4xx isn't retried", statuses: []int{404, 200}, wantErr: true, wantRequests: 1},
+	}
+
+	defer func(d time.Duration) { tooManyRequestsDelay = d }(tooManyRequestsDelay)
+	tooManyRequestsDelay = 200 * time.Millisecond
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// arrange
+			useTempCache(t)
+
+			var requests int64
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := atomic.AddInt64(&requests, 1)
+				status := c.statuses[n-1]
+				if status != http.StatusOK {
+					if c.retryAfter != "" {
+						w.Header().Set("Retry-After", c.retryAfter)
+					}
+					w.WriteHeader(status)
+					return
+				}
+				fmt.Fprint(w, "ok")
+			}))
+			defer server.Close()
+
+			start := time.Now()
+
+			// act
+			got, _, err := Get(context.Background(), Policy{}, server.URL, url.Values{"fen": {"a"}}, nil)
+
+			// assert
+			if (err != nil) != c.wantErr {
+				t.Fatalf("wantErr: %v got: %v", c.wantErr, err)
+			}
+			if c.want != string(got) {
+				t.Errorf("want: %q got: %q", c.want, got)
+			}
+			if n := atomic.LoadInt64(&requests); c.wantRequests != n {
+				t.Errorf("requests want: %d got: %d", c.wantRequests, n)
+			}
+			if elapsed := time.Since(start); elapsed < c.minDuration {
+				t.Errorf("want at least %v got: %v", c.minDuration, elapsed)
+			}
+		})
+	}
+}
+
+func TestGet_TooManyRequestsBlocksHost(t *testing.T) {
+	cases := []struct {
+		name       string
+		retryAfter string
+		wantBlock  time.Duration
+	}{
+		{name: "retry after", retryAfter: "120", wantBlock: 2 * time.Minute},
+		{name: "no retry after", wantBlock: tooManyRequestsDelay},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// arrange
+			useTempCache(t)
+
+			var requests int64
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt64(&requests, 1)
+				if c.retryAfter != "" {
+					w.Header().Set("Retry-After", c.retryAfter)
+				}
+				w.WriteHeader(http.StatusTooManyRequests)
+			}))
+			defer server.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+
+			start := time.Now()
+
+			// act
+			_, _, err := Get(ctx, Policy{}, server.URL, url.Values{"fen": {"a"}}, nil)
+
+			// assert
+			if err == nil {
+				t.Fatal("want error")
+			}
+			if n := atomic.LoadInt64(&requests); n != 1 {
+				t.Errorf("want no retry while the host is blocked, got %d requests", n)
+			}
+
+			host := strings.TrimPrefix(server.URL, "http://")
+			var found bool
+			for _, state := range LimiterStates() {
+				if state.Host == host {
+					found = true
+					if state.BlockedUntil.Before(start.Add(c.wantBlock - time.Second)) {
+						t.Errorf("want host blocked for %v, got until %v", c.wantBlock, state.BlockedUntil)
+					}
+				}
+			}
+			if !found {
+				t.Errorf("want limiter state for %s", host)
+			}
+		})
+	}
+}
+
+func TestGet_LastAttemptTooManyRequestsBlocksHost(t *testing.T) {
+	// arrange
+	useTempCache(t)
+
+	var requests int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt64(&requests, 1) <= maxRetries {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Retry-After", "120")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	start := time.Now()
+
+	// act
+	_, _, err := Get(context.Background(), Policy{}, server.URL, url.Values{"fen": {"a"}}, nil)
+
+	// assert
+	if err == nil {
+		t.Fatal("want error")
+	}
+	if n := atomic.LoadInt64(&requests); n != 1+maxRetries {
+		t.Errorf("requests want: %d got: %d", 1+maxRetries, n)
+	}
+
+	host := strings.TrimPrefix(server.URL, "http://")
+	var found bool
+	for _, state := range LimiterStates() {
+		if state.Host == host {
+			found = true
+			if state.BlockedUntil.Before(start.Add(2*time.Minute - time.Second)) {
+				t.Errorf("want host blocked for 2m, got until %v", state.BlockedUntil)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("want limiter state for %s", host)
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	// arrange
+	useTempCache(t)
+
+	var requests int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		fmt.Fprint(w, "ok")
+	}))
+	defer server.Close()
+
+	host := strings.TrimPrefix(server.URL, "http://")
+	SetRateLimit(host, 20, 1)
+
+	start := time.Now()
+
+	// act
+	for i := 0; i < 5; i++ {
+		if _, _, err := Get(context.Background(), Policy{}, server.URL, url.Values{"n": {fmt.Sprint(i)}}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// assert
+	// the first request takes the burst token, the other four wait 50ms each
+	if elapsed := time.Since(start); elapsed < 180*time.Millisecond {
+		t.Errorf("want at least 200ms got: %v", elapsed)
+	}
+
+	var found bool
+	for _, state := range LimiterStates() {
+		if state.Host == host {
+			found = true
+			if state.PerSecond != 20 || state.Burst != 1 {
+				t.Errorf("want: 20/s burst 1 got: %+v", state)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("want limiter state for %s", host)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, time.May, 15, 12, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		header string
+		want   time.Time
+		ok     bool
+	}{
+		{header: "", ok: false},
+		{header: "120", want: now.Add(2 * time.Minute), ok: true},
+		{header: "Wed, 15 May 2024 12:05:00 GMT", want: now.Add(5 * time.Minute), ok: true},
+		{header: "soon", ok: false},
+		{header: "-1", ok: false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.header, func(t *testing.T) {
+			// act
+			got, ok := retryAfter(c.header, now)
+
+			// assert
+			if c.ok != ok || !c.want.Equal(got) {
+				t.Errorf("want: %v %v got: %v %v", c.want, c.ok, got, ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package httpcache
+
+import (
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const maxRetries = 3
+
+var (
+	// retryBaseDelay is the backoff before the first retry, doubled for each one after. It's a var so
+	// tests can shorten it.
+	retryBaseDelay = 500 * time.Millisecond
+	retryMaxDelay  = 10 * time.Second
+
+	// tooManyRequestsDelay is how long a host is blocked after a 429 without a Retry-After. Lichess asks
+	// clients to wait a full minute. It's a var so tests can shorten it.
+	tooManyRequestsDelay = time.Minute
+)
+
+// retryable reports whether a request that got status may succeed if it's sent again.
+func retryable(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500
+}
+
+// backoff returns a random delay between 0 and the exponential backoff for attempt, which starts at 0.
+func backoff(attempt int) time.Duration {
+	d := retryBaseDelay << attempt
+	if d > retryMaxDelay || d <= 0 {
+		d = retryMaxDelay
+	}
+	return time.Duration(rand.Int63n(int64(d) + 1))
+}
+
+// retryAfter parses a Retry-After header, either delay seconds or an HTTP date. ok is false if the
+// header is missing or invalid.
+func retryAfter(header string, now time.Time) (time.Time, bool) {
+	if header == "" {
+		return time.Time{}, false
+	}
+
+	if seconds, err := strconv.Atoi(header); err == nil && seconds >= 0 {
+		return now.Add(time.Duration(seconds) * time.Second), true
+	}
+
+	if t, err := http.ParseTime(header); err == nil {
+		return t, true
+	}
+
+	return time.Time{}, false
+}
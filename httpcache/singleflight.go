@@ -0,0 +1,77 @@
+package httpcache
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+var (
+	inflight    = make(map[string]*call)
+	inflightMtx sync.Mutex
+)
+
+// call is a fetch shared by every Get for the same query key that arrives while it's running.
+type call struct {
+	done    chan struct{}
+	body    []byte
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// fetchShared fetches the url, or waits for the fetch another caller already started. The fetch isn't
+// bound to any one caller's context: each caller stops waiting when its own context is done, and the
+// fetch is canceled once nobody is waiting for it. onFetch, if set, is called by the caller that started
+// the fetch, even if it has stopped waiting.
+func fetchShared(ctx context.Context, queryKey, endpointURL string, query url.Values, header http.Header, onFetch func([]byte, time.Time)) ([]byte, error) {
+	inflightMtx.Lock()
+	c, ok := inflight[queryKey]
+	if !ok {
+		fetchCtx, cancel := context.WithCancel(context.Background())
+		c = &call{done: make(chan struct{}), cancel: cancel}
+		inflight[queryKey] = c
+
+		go func() {
+			var fetchedAt time.Time
+			c.body, fetchedAt, c.err = fetch(fetchCtx, queryKey, endpointURL, query, header)
+			cancel()
+
+			if c.err == nil && onFetch != nil {
+				onFetch(c.body, fetchedAt)
+			}
+
+			inflightMtx.Lock()
+			if inflight[queryKey] == c {
+				delete(inflight, queryKey)
+			}
+			inflightMtx.Unlock()
+
+			close(c.done)
+		}()
+	}
+	c.waiters++
+	inflightMtx.Unlock()
+
+	select {
+	case <-c.done:
+		return c.body, c.err
+	case <-ctx.Done():
+		inflightMtx.Lock()
+		c.waiters--
+		if c.waiters == 0 {
+			c.cancel()
+			// a caller that arrives now starts a new fetch rather than joining the canceled one
+			if inflight[queryKey] == c {
+				delete(inflight, queryKey)
+			}
+		}
+		inflightMtx.Unlock()
+
+		return nil, xerrors.Errorf("GET %s: %w", endpointURL, ctx.Err())
+	}
+}
@@ -0,0 +1,119 @@
+package httpcache
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGet_Coalesce(t *testing.T) {
+	cases := []struct {
+		name      string
+		waiters   int
+		cancelled int
+	}{
+		{name: "all wait", waiters: 8},
+		{name: "some cancel", waiters: 8, cancelled: 3},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// arrange
+			useTempCache(t)
+
+			var requests int64
+			release := make(chan struct{})
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt64(&requests, 1)
+				<-release
+				w.Write([]byte(`{"moves":[]}`))
+			}))
+			defer server.Close()
+
+			query := url.Values{"fen": {c.name}}
+
+			type result struct {
+				body []byte
+				err  error
+			}
+			results := make([]result, c.waiters)
+			cancels := make([]context.CancelFunc, c.waiters)
+
+			// act
+			var wg sync.WaitGroup
+			for i := 0; i < c.waiters; i++ {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancels[i] = cancel
+				defer cancel()
+
+				wg.Add(1)
+				go func(i int, ctx context.Context) {
+					defer wg.Done()
+					body, _, err := Get(ctx, Policy{}, server.URL, query, nil)
+					results[i] = result{body: body, err: err}
+				}(i, ctx)
+			}
+
+			// wait until the request is in flight, then cancel some waiters before it completes
+			for atomic.LoadInt64(&requests) == 0 {
+				time.Sleep(time.Millisecond)
+			}
+			for i := 0; i < c.cancelled; i++ {
+				cancels[i]()
+			}
+			time.Sleep(20 * time.Millisecond)
+			close(release)
+			wg.Wait()
+
+			// assert
+			if n := atomic.LoadInt64(&requests); n != 1 {
+				t.Errorf("requests want: 1 got: %d", n)
+			}
+			for i, r := range results {
+				if i < c.cancelled {
+					if !errors.Is(r.err, context.Canceled) {
+						t.Errorf("waiter %d want: context.Canceled got: %v", i, r.err)
+					}
+					continue
+				}
+				if r.err != nil || string(r.body) != `{"moves":[]}` {
+					t.Errorf("waiter %d want: %s got: %s, %v", i, `{"moves":[]}`, r.body, r.err)
+				}
+			}
+		})
+	}
+}
+
+func TestGet_CoalesceAllCancelled(t *testing.T) {
+	// arrange
+	useTempCache(t)
+
+	cancelled := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		close(cancelled)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	// act
+	_, _, err := Get(ctx, Policy{}, server.URL, url.Values{"fen": {"a"}}, nil)
+
+	// assert
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("want: context.DeadlineExceeded got: %v", err)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Error("request wasn't canceled after its only waiter left")
+	}
+}
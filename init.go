@@ -1,10 +0,0 @@
-package main
-
-import (
-	"math/rand"
-	"time"
-)
-
-func init() {
-	rand.Seed(time.Now().Unix())
-}
@@ -1,47 +1,130 @@
 package lichess
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"golang.org/x/xerrors"
 
 	"automock/httpcache"
+	"automock/store"
+	"automock/utils"
 )
 
 func GetLichessGames(ctx context.Context, req OpeningExplorerRequest) (OpeningExplorerResponse, error) {
-	response, cacheHit, err := getLichessGames(ctx, false, req)
+	const endpointURL = "https://explorer.lichess.ovh/lichess"
+
+	return getExplorer(ctx, req.StoreKey(), req.cachePolicy(time.Now()), endpointURL, req.QueryString(), parseExplorerResponse)
+}
+
+// GetMastersGames returns the moves played from a position in OTB games between masters.
+func GetMastersGames(ctx context.Context, req MastersExplorerRequest) (OpeningExplorerResponse, error) {
+	const endpointURL = "https://explorer.lichess.ovh/masters"
+
+	return getExplorer(ctx, req.StoreKey(), req.cachePolicy(time.Now()), endpointURL, req.QueryString(), parseExplorerResponse)
+}
+
+// GetPlayerGames returns the moves a single player has played from a position, as req.Color.
+func GetPlayerGames(ctx context.Context, req PlayerExplorerRequest) (OpeningExplorerResponse, error) {
+	const endpointURL = "https://explorer.lichess.ovh/player"
+
+	return getExplorer(ctx, req.StoreKey(), playerPolicy, endpointURL, req.QueryString(), ParsePlayerGames)
+}
+
+// getExplorer answers an explorer request from the store while it's fresh, and otherwise through
+// httpcache. Every response httpcache fetches, including background refreshes, is recorded in the store,
+// as is a cached response the store doesn't have yet. Offline, httpcache is asked first, so the newer of
+// its response and the store's is used.
+func getExplorer(ctx context.Context, key store.Key, policy httpcache.Policy, endpointURL string, query url.Values, parse func([]byte) (OpeningExplorerResponse, error)) (OpeningExplorerResponse, error) {
+	if !httpcache.Offline() {
+		if response, ok := lookupStore(key, policy); ok {
+			return response, nil
+		}
+	}
+
+	policy.OnFetch = func(b []byte, fetchedAt time.Time) {
+		response, err := parse(b)
+		if err != nil {
+			utils.Log(fmt.Sprintf("store: %s", err.Error()))
+			return
+		}
+		recordStore(key, endpointURL, response, fetchedAt)
+	}
+
+	b, cacheHit, err := httpcache.Get(ctx, policy, endpointURL, query, authHeader)
 	if err != nil {
+		if httpcache.Offline() {
+			if response, ok := lookupStore(key, policy); ok {
+				return response, nil
+			}
+		}
 		return OpeningExplorerResponse{}, xerrors.Errorf("%w", err)
 	}
 
-	if cacheHit && len(response.Moves) == 0 {
-		response, _, err = getLichessGames(ctx, true, req)
-		if err != nil {
-			return OpeningExplorerResponse{}, xerrors.Errorf("%w", err)
+	response, err := parse(b)
+	if err != nil {
+		return OpeningExplorerResponse{}, xerrors.Errorf("%w", err)
+	}
+
+	if cacheHit {
+		if fetchedAt, ok := httpcache.FetchedAt(endpointURL, query); ok {
+			backfillStore(key, endpointURL, response, fetchedAt)
 		}
 	}
 
 	return response, nil
 }
 
-func getLichessGames(ctx context.Context, skipCache bool, req OpeningExplorerRequest) (OpeningExplorerResponse, bool, error) {
-	const endpointURL = "https://explorer.lichess.ovh/lichess"
+func parseExplorerResponse(b []byte) (OpeningExplorerResponse, error) {
+	var response OpeningExplorerResponse
+	if err := json.Unmarshal(b, &response); err != nil {
+		return OpeningExplorerResponse{}, xerrors.Errorf("%w", err)
+	}
+	return response, nil
+}
 
-	b, cacheHit, err := httpcache.Get(ctx, skipCache, endpointURL, req.QueryString(), authHeader)
-	if err != nil {
-		return OpeningExplorerResponse{}, cacheHit, xerrors.Errorf("%w", err)
+// ParsePlayerGames parses the NDJSON stream from the player endpoint. Lichess indexes the player's games
+// on demand and sends an updated snapshot of the whole response on each line, so the last line is the
+// most complete.
+func ParsePlayerGames(b []byte) (OpeningExplorerResponse, error) {
+	var (
+		response OpeningExplorerResponse
+		found    bool
+	)
+
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var snapshot OpeningExplorerResponse
+		if err := json.Unmarshal(line, &snapshot); err != nil {
+			return OpeningExplorerResponse{}, xerrors.Errorf("player games: %w", err)
+		}
+
+		response = snapshot
+		found = true
+	}
+	if err := scanner.Err(); err != nil {
+		return OpeningExplorerResponse{}, xerrors.Errorf("player games: %w", err)
 	}
 
-	var response OpeningExplorerResponse
-	if err := json.Unmarshal(b, &response); err != nil {
-		return OpeningExplorerResponse{}, cacheHit, xerrors.Errorf("%w", err)
+	if !found {
+		return OpeningExplorerResponse{}, xerrors.New("player games: empty response")
 	}
 
-	return response, cacheHit, nil
+	return response, nil
 }
 
 type CloudEvalResponse struct {
@@ -49,6 +132,9 @@ type CloudEvalResponse struct {
 	KNodes int           `json:"knodes"`
 	Depth  int           `json:"depth"`
 	PVs    []CloudEvalPV `json:"pvs"`
+
+	// FetchedAt dates the evaluation, so a cached eval loses to a fresher one of the same depth.
+	FetchedAt time.Time `json:"-"`
 }
 
 type CloudEvalPV struct {
@@ -59,22 +145,6 @@ type CloudEvalPV struct {
 }
 
 func GetCloudEval(ctx context.Context, fen string, multiPV int) (CloudEvalResponse, error) {
-	response, cacheHit, err := getCloudEval(ctx, false, fen, multiPV)
-	if err != nil {
-		return CloudEvalResponse{}, xerrors.Errorf("%w", err)
-	}
-
-	if cacheHit && len(response.PVs) == 0 {
-		response, _, err = getCloudEval(ctx, false, fen, multiPV)
-		if err != nil {
-			return CloudEvalResponse{}, xerrors.Errorf("%w", err)
-		}
-	}
-
-	return response, nil
-}
-
-func getCloudEval(ctx context.Context, skipCache bool, fen string, multiPV int) (CloudEvalResponse, bool, error) {
 	// https://lichess.org/api/cloud-eval?fen=rnbqkbnr/pppp1ppp/8/4p3/6P1/5P2/PPPPP2P/RNBQKBNR%20b%20KQkq%20-%200%202&multiPv=3
 	const endpointURL = "https://lichess.org/api/cloud-eval"
 
@@ -82,15 +152,16 @@ func getCloudEval(ctx context.Context, skipCache bool, fen string, multiPV int)
 	params.Set("fen", fen)
 	params.Set("multiPv", strconv.Itoa(multiPV))
 
-	b, cacheHit, err := httpcache.Get(ctx, skipCache, endpointURL, params, authHeader)
+	b, _, err := httpcache.Get(ctx, cloudEvalPolicy, endpointURL, params, authHeader)
 	if err != nil {
-		return CloudEvalResponse{}, cacheHit, xerrors.Errorf("%w", err)
+		return CloudEvalResponse{}, xerrors.Errorf("%w", err)
 	}
 
 	var response CloudEvalResponse
 	if err := json.Unmarshal(b, &response); err != nil {
-		return CloudEvalResponse{}, cacheHit, xerrors.Errorf("%w", err)
+		return CloudEvalResponse{}, xerrors.Errorf("%w", err)
 	}
+	response.FetchedAt, _ = httpcache.FetchedAt(endpointURL, params)
 
 	// NOTE: Response has been seen with duplicates.
 	// URL: https://lichess.org/api/cloud-eval?fen=rnbqkb1r%2Fp1pppppp%2F1p3n2%2F8%2F8%2F1P3N2%2FPBPPPPPP%2FRN1QKB1R+b+KQkq+-+1+3&multiPv=3
@@ -155,5 +226,5 @@ func getCloudEval(ctx context.Context, skipCache bool, fen string, multiPV int)
 		seen[uci] = struct{}{}
 	}
 
-	return response, cacheHit, nil
+	return response, nil
 }
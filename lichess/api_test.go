@@ -0,0 +1,63 @@
+package lichess
+
+import (
+	"os"
+	"testing"
+)
+
+func TestParsePlayerGames(t *testing.T) {
+	b, err := os.ReadFile("testdata/player.ndjson")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// act
+	got, err := ParsePlayerGames(b)
+
+	// assert
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the last line of the stream is the most complete
+	if got.Total() != 66 {
+		t.Errorf("want total: %d got: %d", 66, got.Total())
+	}
+
+	wantMoves := []OpeningExplorerMove{
+		{UCI: "e2e4", SAN: "e4", White: 31, Draws: 4, Black: 13},
+		{UCI: "d2d4", SAN: "d4", White: 8, Draws: 1, Black: 7},
+		{UCI: "g1f3", SAN: "Nf3", White: 1, Draws: 0, Black: 0},
+	}
+	if len(wantMoves) != len(got.Moves) {
+		t.Fatalf("want moves: %v got: %v", wantMoves, got.Moves)
+	}
+	for i := range wantMoves {
+		if wantMoves[i] != got.Moves[i] {
+			t.Errorf("move %d: want: %v got: %v", i, wantMoves[i], got.Moves[i])
+		}
+	}
+}
+
+func TestParsePlayerGames_Errors(t *testing.T) {
+	cases := []struct {
+		name  string
+		input string
+	}{
+		{name: "empty", input: ""},
+		{name: "blank lines", input: "\n\n"},
+		{name: "truncated", input: "{\"white\":1,\"draws\":0,\"black\":0,\"moves\":[]}\n{\"white\":2,"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// act
+			_, err := ParsePlayerGames([]byte(c.input))
+
+			// assert
+			if err == nil {
+				t.Errorf("want error, got nil")
+			}
+		})
+	}
+}
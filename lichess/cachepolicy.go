@@ -0,0 +1,68 @@
+package lichess
+
+import (
+	"encoding/json"
+	"time"
+
+	"automock/httpcache"
+)
+
+const (
+	// explorerTTL applies while the query's date range is still open, so new games can change the answer
+	explorerTTL  = 30 * 24 * time.Hour
+	playerTTL    = 7 * 24 * time.Hour
+	cloudEvalTTL = 30 * 24 * time.Hour
+)
+
+var (
+	playerPolicy = httpcache.Policy{
+		TTL:                  playerTTL,
+		StaleWhileRevalidate: true,
+		StaleIfError:         true,
+		Empty: func(b []byte) bool {
+			response, err := ParsePlayerGames(b)
+			return err != nil || len(response.Moves) == 0
+		},
+	}
+
+	cloudEvalPolicy = httpcache.Policy{
+		TTL:                  cloudEvalTTL,
+		StaleWhileRevalidate: true,
+		StaleIfError:         true,
+		Empty: func(b []byte) bool {
+			var response CloudEvalResponse
+			return json.Unmarshal(b, &response) != nil || len(response.PVs) == 0
+		},
+	}
+)
+
+// cachePolicy caches the response forever if Until is a month that has ended, since no more games can
+// be added to the range.
+func (r OpeningExplorerRequest) cachePolicy(now time.Time) httpcache.Policy {
+	policy := explorerPolicy()
+	if !r.Until.IsZero() && r.Until.Year*12+r.Until.Month < now.Year()*12+int(now.Month()) {
+		policy.TTL = 0
+	}
+	return policy
+}
+
+// cachePolicy caches the response forever if Until is a year that has ended.
+func (r MastersExplorerRequest) cachePolicy(now time.Time) httpcache.Policy {
+	policy := explorerPolicy()
+	if r.Until != 0 && r.Until < now.Year() {
+		policy.TTL = 0
+	}
+	return policy
+}
+
+func explorerPolicy() httpcache.Policy {
+	return httpcache.Policy{
+		TTL:                  explorerTTL,
+		StaleWhileRevalidate: true,
+		StaleIfError:         true,
+		Empty: func(b []byte) bool {
+			var response OpeningExplorerResponse
+			return json.Unmarshal(b, &response) != nil || len(response.Moves) == 0
+		},
+	}
+}
@@ -0,0 +1,34 @@
+package lichess
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOpeningExplorerRequest_cachePolicy(t *testing.T) {
+	now := time.Date(2024, time.May, 15, 0, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name  string
+		until Date
+		want  time.Duration
+	}{
+		{name: "open ended", until: Date{}, want: explorerTTL},
+		{name: "current month", until: Date{Year: 2024, Month: 5}, want: explorerTTL},
+		{name: "future", until: Date{Year: 2025, Month: 1}, want: explorerTTL},
+		{name: "last month", until: Date{Year: 2024, Month: 4}, want: 0},
+		{name: "last year", until: Date{Year: 2023, Month: 12}, want: 0},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// act
+			got := OpeningExplorerRequest{Until: c.until}.cachePolicy(now)
+
+			// assert
+			if c.want != got.TTL {
+				t.Errorf("want: %v got: %v", c.want, got.TTL)
+			}
+		})
+	}
+}
@@ -11,6 +11,7 @@ import (
 var (
 	ValidSpeeds  = Speeds{UltraBullet, Bullet, Blitz, Rapid, Classical, Correspondence}
 	ValidRatings = Ratings{R0, R1000, R1200, R1400, R1600, R1800, R2000, R2200, R2500}
+	ValidModes   = Modes{Casual, Rated}
 
 	speedsOrder = map[Speed]int{
 		UltraBullet:    1,
@@ -39,6 +40,12 @@ const (
 	R2000 Rating = 2000
 	R2200 Rating = 2200
 	R2500 Rating = 2500
+
+	Casual Mode = "casual"
+	Rated  Mode = "rated"
+
+	White Color = "white"
+	Black Color = "black"
 )
 
 // date
@@ -116,6 +123,17 @@ func (r Rating) String() string {
 	return strconv.Itoa(int(r))
 }
 
+// RatingBucket returns the rating bucket a rating falls in, e.g. 1600 for 1600-1799.
+func RatingBucket(rating int) Rating {
+	bucket := ValidRatings[0]
+	for _, r := range ValidRatings {
+		if rating >= int(r) {
+			bucket = r
+		}
+	}
+	return bucket
+}
+
 type Ratings []Rating
 
 func (r Ratings) String() string {
@@ -125,3 +143,25 @@ func (r Ratings) String() string {
 func (r Ratings) Contains(v string) (Rating, bool) {
 	return utils.StringerSliceContains(r, v)
 }
+
+// modes
+
+type Mode string
+
+func (m Mode) String() string {
+	return string(m)
+}
+
+type Modes []Mode
+
+func (m Modes) String() string {
+	return utils.StringerSliceToString(m)
+}
+
+// color
+
+type Color string
+
+func (c Color) String() string {
+	return string(c)
+}
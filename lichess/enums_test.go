@@ -0,0 +1,26 @@
+package lichess
+
+import "testing"
+
+func TestRatingBucket(t *testing.T) {
+	cases := []struct {
+		rating int
+		want   Rating
+	}{
+		{rating: 400, want: R0},
+		{rating: 1000, want: R1000},
+		{rating: 1799, want: R1600},
+		{rating: 2499, want: R2200},
+		{rating: 3100, want: R2500},
+	}
+
+	for _, c := range cases {
+		// act
+		got := RatingBucket(c.rating)
+
+		// assert
+		if c.want != got {
+			t.Errorf("rating %d want: %v got: %v", c.rating, c.want, got)
+		}
+	}
+}
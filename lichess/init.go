@@ -1,24 +1,22 @@
 package lichess
 
 import (
-	"fmt"
 	"net/http"
-	"os"
 
 	"automock/utils"
 )
 
-var lichessAPIToken string
 var authHeader = make(http.Header)
 
-const apiTokenEnvName = "LICHESS_API_TOKEN"
+// SetAPIToken sets the personal API token sent with Lichess requests. An empty token sends none.
+func SetAPIToken(token string) {
+	header := make(http.Header)
 
-func init() {
-	lichessAPIToken = os.Getenv(apiTokenEnvName)
-	if lichessAPIToken == "" {
-		utils.Log(fmt.Sprintf("NOTE: Set `%s` env for a slightly better Lichess API experience.", apiTokenEnvName))
-		return
+	if token == "" {
+		utils.Log("NOTE: Set `lichess_api_token` in the config file or the `LICHESS_API_TOKEN` env for a slightly better Lichess API experience.")
+	} else {
+		header.Set("Authorization", "Bearer "+token)
 	}
 
-	authHeader.Set("Authorization", fmt.Sprintf("Bearer %s", lichessAPIToken))
+	authHeader = header
 }
@@ -0,0 +1,52 @@
+package lichess
+
+import (
+	"net/url"
+	"strconv"
+
+	"automock/bitboard"
+)
+
+// MastersExplorerRequest queries the OTB masters database. Unlike the lichess database it has no speeds
+// or ratings, and Since/Until are years.
+type MastersExplorerRequest struct {
+	FEN      string
+	Play     string
+	Since    int
+	Until    int
+	Moves    int
+	TopGames int
+}
+
+func (r MastersExplorerRequest) QueryString() url.Values {
+	// set defaults
+
+	if r.FEN == "" || r.FEN == "startpos" {
+		r.FEN = bitboard.StartPos
+	}
+	if r.Moves == 0 {
+		r.Moves = 20
+	}
+
+	// set query param values
+
+	values := make(url.Values)
+
+	values.Set("fen", r.FEN)
+
+	if r.Play != "" {
+		values.Set("play", r.Play)
+	}
+
+	if r.Since != 0 {
+		values.Set("since", strconv.Itoa(r.Since))
+	}
+	if r.Until != 0 {
+		values.Set("until", strconv.Itoa(r.Until))
+	}
+
+	values.Set("moves", strconv.Itoa(r.Moves))
+	values.Set("topGames", strconv.Itoa(r.TopGames))
+
+	return values
+}
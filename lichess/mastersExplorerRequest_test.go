@@ -0,0 +1,39 @@
+package lichess
+
+import (
+	"net/url"
+	"testing"
+
+	"automock/bitboard"
+)
+
+func TestMastersExplorerRequest_QueryString(t *testing.T) {
+	cases := []struct {
+		name string
+		req  MastersExplorerRequest
+		want string
+	}{
+		{
+			name: "defaults",
+			req:  MastersExplorerRequest{FEN: "startpos"},
+			want: "fen=" + url.QueryEscape(bitboard.StartPos) + "&moves=20&topGames=0",
+		},
+		{
+			name: "play and years",
+			req:  MastersExplorerRequest{FEN: bitboard.StartPos, Play: "e2e4,c7c5", Since: 1990, Until: 2020, Moves: 5, TopGames: 2},
+			want: "fen=" + url.QueryEscape(bitboard.StartPos) + "&moves=5&play=e2e4%2Cc7c5&since=1990&topGames=2&until=2020",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// act
+			got := c.req.QueryString().Encode()
+
+			// assert
+			if c.want != got {
+				t.Errorf("want: %s got: %s", c.want, got)
+			}
+		})
+	}
+}
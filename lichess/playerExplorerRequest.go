@@ -0,0 +1,71 @@
+package lichess
+
+import (
+	"net/url"
+	"strconv"
+
+	"automock/bitboard"
+)
+
+// PlayerExplorerRequest queries the games of a single Lichess player, from the point of view of Color.
+type PlayerExplorerRequest struct {
+	Player      string
+	Color       Color
+	Variant     string
+	FEN         string
+	Play        string
+	Speeds      Speeds
+	Modes       Modes
+	Since       Date
+	Until       Date
+	Moves       int
+	RecentGames int
+}
+
+func (r PlayerExplorerRequest) QueryString() url.Values {
+	// set defaults
+
+	if r.Variant == "" {
+		r.Variant = "standard"
+	}
+	if r.FEN == "" || r.FEN == "startpos" {
+		r.FEN = bitboard.StartPos
+	}
+	if r.Moves == 0 {
+		r.Moves = 20
+	}
+	if len(r.Speeds) == 0 {
+		r.Speeds = ValidSpeeds
+	}
+	if len(r.Modes) == 0 {
+		r.Modes = ValidModes
+	}
+
+	// set query param values
+
+	values := make(url.Values)
+
+	values.Set("player", r.Player)
+	values.Set("color", r.Color.String())
+	values.Set("variant", r.Variant)
+	values.Set("fen", r.FEN)
+
+	if r.Play != "" {
+		values.Set("play", r.Play)
+	}
+
+	values.Set("speeds", r.Speeds.String())
+	values.Set("modes", r.Modes.String())
+
+	if !r.Since.IsZero() {
+		values.Set("since", r.Since.String())
+	}
+	if !r.Until.IsZero() {
+		values.Set("until", r.Until.String())
+	}
+
+	values.Set("moves", strconv.Itoa(r.Moves))
+	values.Set("recentGames", strconv.Itoa(r.RecentGames))
+
+	return values
+}
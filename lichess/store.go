@@ -0,0 +1,266 @@
+package lichess
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"automock/bitboard"
+	"automock/httpcache"
+	"automock/store"
+	"automock/utils"
+)
+
+var (
+	positionStore *store.Store
+	storeMaxAge   time.Duration
+)
+
+// SetStore records the explorer responses fetched from the network in s, and answers explorer requests
+// from it while the entry is fresh under the endpoint's cache policy. maxAge, if set, is the most a
+// stored response is trusted for even if the policy keeps it forever. A nil store turns this off.
+func SetStore(s *store.Store, maxAge time.Duration) {
+	positionStore = s
+	storeMaxAge = maxAge
+}
+
+// lookupStore returns the stored response for key if it's fresh under policy. A stale response is left to
+// httpcache.Get, which knows whether to serve it while revalidating. Empty responses are never answered
+// from the store, so the policy gets to fetch them again. Offline, any stored response with moves is
+// better than none, so its age isn't checked.
+func lookupStore(key store.Key, policy httpcache.Policy) (OpeningExplorerResponse, bool) {
+	if positionStore == nil || key.FEN == "" {
+		return OpeningExplorerResponse{}, false
+	}
+
+	var (
+		entry store.Entry
+		ok    bool
+		err   error
+	)
+	if maxAge := storeAge(policy); httpcache.Offline() || maxAge == 0 {
+		entry, ok, err = positionStore.Get(key)
+	} else {
+		entry, ok, err = positionStore.GetFresh(key, maxAge)
+	}
+	if err != nil {
+		utils.Log(fmt.Sprintf("store: %s", err.Error()))
+		return OpeningExplorerResponse{}, false
+	}
+	if !ok || entry.Status == store.StatusEmpty {
+		return OpeningExplorerResponse{}, false
+	}
+
+	var response OpeningExplorerResponse
+	if err := json.Unmarshal(entry.Response, &response); err != nil {
+		utils.Log(fmt.Sprintf("store: %s", err.Error()))
+		return OpeningExplorerResponse{}, false
+	}
+
+	return response, true
+}
+
+// storeAge returns how old a stored response can be under policy, the shorter of its TTL and the store's
+// max age. 0 means any age.
+func storeAge(policy httpcache.Policy) time.Duration {
+	switch {
+	case policy.TTL == 0:
+		return storeMaxAge
+	case storeMaxAge == 0 || policy.TTL < storeMaxAge:
+		return policy.TTL
+	default:
+		return storeMaxAge
+	}
+}
+
+// recordStore stores response as fetched from endpointURL at fetchedAt.
+func recordStore(key store.Key, endpointURL string, response OpeningExplorerResponse, fetchedAt time.Time) {
+	if positionStore == nil || key.FEN == "" {
+		return
+	}
+
+	b, err := json.Marshal(response)
+	if err != nil {
+		utils.Log(fmt.Sprintf("store: %s", err.Error()))
+		return
+	}
+
+	status := store.StatusOK
+	if len(response.Moves) == 0 {
+		status = store.StatusEmpty
+	}
+
+	entry := store.Entry{
+		Key:       key,
+		Source:    strings.TrimPrefix(endpointURL, "https://"),
+		Status:    status,
+		FetchedAt: fetchedAt,
+		Response:  b,
+	}
+
+	if err := positionStore.Put(entry); err != nil {
+		utils.Log(fmt.Sprintf("store: %s", err.Error()))
+	}
+}
+
+// backfillStore stores a response httpcache served from its cache, unless the store already has one
+// fetched as recently.
+func backfillStore(key store.Key, endpointURL string, response OpeningExplorerResponse, fetchedAt time.Time) {
+	if positionStore == nil || key.FEN == "" {
+		return
+	}
+
+	entry, ok, err := positionStore.Get(key)
+	if err != nil {
+		utils.Log(fmt.Sprintf("store: %s", err.Error()))
+		return
+	}
+	if ok && !entry.FetchedAt.Before(fetchedAt) {
+		return
+	}
+
+	recordStore(key, endpointURL, response, fetchedAt)
+}
+
+// StoreKey returns the normalized request. The key is empty if the position can't be reached.
+func (r OpeningExplorerRequest) StoreKey() store.Key {
+	fenKey, err := positionKey(r.FEN, r.Play)
+	if err != nil {
+		return store.Key{}
+	}
+
+	speeds := r.Speeds
+	if len(speeds) == 0 {
+		speeds = ValidSpeeds
+	}
+	ratings := r.Ratings
+	if len(ratings) == 0 {
+		ratings = ValidRatings
+	}
+
+	return store.Key{
+		Database:    "lichess",
+		Variant:     variantOrDefault(r.Variant),
+		FEN:         fenKey,
+		Speeds:      sortedSpeeds(speeds).String(),
+		Ratings:     sortedRatings(ratings).String(),
+		Since:       r.Since.String(),
+		Until:       r.Until.String(),
+		Moves:       movesOrDefault(r.Moves),
+		TopGames:    r.TopGames,
+		RecentGames: r.RecentGames,
+		History:     r.History,
+	}
+}
+
+func (r MastersExplorerRequest) StoreKey() store.Key {
+	fenKey, err := positionKey(r.FEN, r.Play)
+	if err != nil {
+		return store.Key{}
+	}
+
+	key := store.Key{
+		Database: "masters",
+		FEN:      fenKey,
+		Moves:    movesOrDefault(r.Moves),
+		TopGames: r.TopGames,
+	}
+	if r.Since != 0 {
+		key.Since = strconv.Itoa(r.Since)
+	}
+	if r.Until != 0 {
+		key.Until = strconv.Itoa(r.Until)
+	}
+
+	return key
+}
+
+func (r PlayerExplorerRequest) StoreKey() store.Key {
+	fenKey, err := positionKey(r.FEN, r.Play)
+	if err != nil {
+		return store.Key{}
+	}
+
+	speeds := r.Speeds
+	if len(speeds) == 0 {
+		speeds = ValidSpeeds
+	}
+	modes := r.Modes
+	if len(modes) == 0 {
+		modes = ValidModes
+	}
+
+	return store.Key{
+		Database:    "player",
+		Variant:     variantOrDefault(r.Variant),
+		FEN:         fenKey,
+		Speeds:      sortedSpeeds(speeds).String(),
+		Modes:       sortedModes(modes).String(),
+		Since:       r.Since.String(),
+		Until:       r.Until.String(),
+		Player:      strings.ToLower(r.Player) + "/" + r.Color.String(),
+		Moves:       movesOrDefault(r.Moves),
+		RecentGames: r.RecentGames,
+	}
+}
+
+// variantOrDefault and movesOrDefault fill in the defaults QueryString sends.
+func variantOrDefault(variant string) string {
+	if variant == "" {
+		return "standard"
+	}
+	return variant
+}
+
+func movesOrDefault(moves int) int {
+	if moves == 0 {
+		return 20
+	}
+	return moves
+}
+
+// positionKey returns the FENKey of the position after play, a comma separated list of UCI moves.
+func positionKey(fen, play string) (string, error) {
+	if fen == "" {
+		fen = "startpos"
+	}
+
+	b, err := bitboard.ParseFEN(fen)
+	if err != nil {
+		return "", xerrors.Errorf("%w", err)
+	}
+
+	if play != "" {
+		if b, err = b.Apply(strings.Split(play, ",")...); err != nil {
+			return "", xerrors.Errorf("%w", err)
+		}
+	}
+
+	return b.FENKey(), nil
+}
+
+func sortedSpeeds(speeds Speeds) Speeds {
+	sorted := make(Speeds, len(speeds))
+	copy(sorted, speeds)
+	sort.Sort(sorted)
+	return sorted
+}
+
+func sortedModes(modes Modes) Modes {
+	sorted := make(Modes, len(modes))
+	copy(sorted, modes)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted
+}
+
+func sortedRatings(ratings Ratings) Ratings {
+	sorted := make(Ratings, len(ratings))
+	copy(sorted, ratings)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted
+}
@@ -0,0 +1,294 @@
+package lichess
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"automock/httpcache"
+	"automock/store"
+)
+
+func TestOpeningExplorerRequest_StoreKey(t *testing.T) {
+	cases := []struct {
+		name  string
+		a     OpeningExplorerRequest
+		b     OpeningExplorerRequest
+		equal bool
+	}{
+		{
+			name:  "transposition",
+			a:     OpeningExplorerRequest{FEN: "startpos", Play: "g1f3,g8f6,d2d4"},
+			b:     OpeningExplorerRequest{FEN: "startpos", Play: "d2d4,g8f6,g1f3"},
+			equal: true,
+		},
+		{
+			name:  "fen or moves",
+			a:     OpeningExplorerRequest{FEN: "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq - 0 1"},
+			b:     OpeningExplorerRequest{FEN: "startpos", Play: "e2e4"},
+			equal: true,
+		},
+		{
+			name:  "speeds order",
+			a:     OpeningExplorerRequest{Speeds: Speeds{Rapid, Blitz}},
+			b:     OpeningExplorerRequest{Speeds: Speeds{Blitz, Rapid}},
+			equal: true,
+		},
+		{
+			name:  "default speeds and ratings",
+			a:     OpeningExplorerRequest{},
+			b:     OpeningExplorerRequest{Speeds: ValidSpeeds, Ratings: ValidRatings},
+			equal: true,
+		},
+		{
+			name:  "ratings",
+			a:     OpeningExplorerRequest{Ratings: Ratings{R1600}},
+			b:     OpeningExplorerRequest{Ratings: Ratings{R1800}},
+			equal: false,
+		},
+		{
+			name:  "until",
+			a:     OpeningExplorerRequest{},
+			b:     OpeningExplorerRequest{Until: Date{Year: 2023, Month: 1}},
+			equal: false,
+		},
+		{
+			name:  "default variant and moves",
+			a:     OpeningExplorerRequest{},
+			b:     OpeningExplorerRequest{Variant: "standard", Moves: 20},
+			equal: true,
+		},
+		{
+			name:  "moves",
+			a:     OpeningExplorerRequest{Moves: 5},
+			b:     OpeningExplorerRequest{Moves: 20},
+			equal: false,
+		},
+		{
+			name:  "variant",
+			a:     OpeningExplorerRequest{},
+			b:     OpeningExplorerRequest{Variant: "chess960"},
+			equal: false,
+		},
+		{
+			name:  "top games",
+			a:     OpeningExplorerRequest{},
+			b:     OpeningExplorerRequest{TopGames: 4},
+			equal: false,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// act
+			a, b := c.a.StoreKey(), c.b.StoreKey()
+
+			// assert
+			if a.FEN == "" || b.FEN == "" {
+				t.Fatalf("empty key: %+v %+v", a, b)
+			}
+			if c.equal != (a == b) {
+				t.Errorf("equal want: %v a: %+v b: %+v", c.equal, a, b)
+			}
+		})
+	}
+}
+
+func TestMastersAndPlayerExplorerRequest_StoreKey(t *testing.T) {
+	cases := []struct {
+		name  string
+		a     interface{ StoreKey() store.Key }
+		b     interface{ StoreKey() store.Key }
+		equal bool
+	}{
+		{
+			name:  "masters default moves",
+			a:     MastersExplorerRequest{},
+			b:     MastersExplorerRequest{Moves: 20},
+			equal: true,
+		},
+		{
+			name:  "masters moves",
+			a:     MastersExplorerRequest{Moves: 5},
+			b:     MastersExplorerRequest{Moves: 20},
+			equal: false,
+		},
+		{
+			name:  "masters top games",
+			a:     MastersExplorerRequest{},
+			b:     MastersExplorerRequest{TopGames: 4},
+			equal: false,
+		},
+		{
+			name:  "player modes order",
+			a:     PlayerExplorerRequest{Player: "someone", Modes: Modes{Rated, Casual}},
+			b:     PlayerExplorerRequest{Player: "someone"},
+			equal: true,
+		},
+		{
+			name:  "player modes",
+			a:     PlayerExplorerRequest{Player: "someone", Modes: Modes{Rated}},
+			b:     PlayerExplorerRequest{Player: "someone"},
+			equal: false,
+		},
+		{
+			name:  "player variant",
+			a:     PlayerExplorerRequest{Player: "someone", Variant: "chess960"},
+			b:     PlayerExplorerRequest{Player: "someone"},
+			equal: false,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// act
+			a, b := c.a.StoreKey(), c.b.StoreKey()
+
+			// assert
+			if a.FEN == "" || b.FEN == "" {
+				t.Fatalf("empty key: %+v %+v", a, b)
+			}
+			if c.equal != (a == b) {
+				t.Errorf("equal want: %v a: %+v b: %+v", c.equal, a, b)
+			}
+		})
+	}
+}
+
+func TestLookupStore(t *testing.T) {
+	key := OpeningExplorerRequest{FEN: "startpos"}.StoreKey()
+	day := 24 * time.Hour
+
+	cases := []struct {
+		name    string
+		status  string
+		age     time.Duration
+		policy  httpcache.Policy
+		offline bool
+		found   bool
+	}{
+		{name: "fresh", status: store.StatusOK, age: day, policy: explorerPolicy(), found: true},
+		{name: "older than the explorer ttl", status: store.StatusOK, age: 31 * day, policy: explorerPolicy(), found: false},
+		{name: "older than the player ttl", status: store.StatusOK, age: 8 * day, policy: playerPolicy, found: false},
+		{name: "ended until is capped by the max age", status: store.StatusOK, age: 61 * day, policy: httpcache.Policy{}, found: false},
+		{name: "ended until within the max age", status: store.StatusOK, age: 59 * day, policy: httpcache.Policy{}, found: true},
+		{name: "empty", status: store.StatusEmpty, age: time.Minute, policy: explorerPolicy(), found: false},
+		{name: "offline ignores the age", status: store.StatusOK, age: 100 * day, policy: playerPolicy, offline: true, found: true},
+		{name: "offline empty", status: store.StatusEmpty, age: day, policy: explorerPolicy(), offline: true, found: false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// arrange
+			s, err := store.Open(filepath.Join(t.TempDir(), "store.db"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+			SetStore(s, 60*day)
+			defer SetStore(nil, 0)
+
+			httpcache.SetOffline(c.offline)
+			defer httpcache.SetOffline(false)
+
+			entry := store.Entry{
+				Key:       key,
+				Status:    c.status,
+				FetchedAt: time.Now().Add(-c.age),
+				Response:  json.RawMessage(`{"white":1,"moves":[{"uci":"e2e4","white":1}]}`),
+			}
+			if err := s.Put(entry); err != nil {
+				t.Fatal(err)
+			}
+
+			// act
+			_, found := lookupStore(key, c.policy)
+
+			// assert
+			if c.found != found {
+				t.Errorf("found want: %v got: %v", c.found, found)
+			}
+		})
+	}
+}
+
+func TestGetExplorer_RecordsStore(t *testing.T) {
+	// arrange
+	httpcache.SetCacheDir(t.TempDir())
+	defer httpcache.SetCacheDir("./cache")
+
+	s, err := store.Open(filepath.Join(t.TempDir(), "store.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	var requests int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt64(&requests, 1)
+		fmt.Fprintf(w, `{"white":%d,"moves":[{"uci":"e2e4","white":%d}]}`, n, n)
+	}))
+	defer server.Close()
+
+	req := OpeningExplorerRequest{FEN: "startpos"}
+	key := req.StoreKey()
+	revalidate := httpcache.Policy{TTL: time.Nanosecond, StaleWhileRevalidate: true}
+
+	storedWhite := func() int {
+		entry, ok, err := s.Get(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			return 0
+		}
+		var response OpeningExplorerResponse
+		if err := json.Unmarshal(entry.Response, &response); err != nil {
+			t.Fatal(err)
+		}
+		return response.White
+	}
+
+	// act: cache the first response before the store is in use
+	if _, err := getExplorer(context.Background(), key, httpcache.Policy{}, server.URL, req.QueryString(), parseExplorerResponse); err != nil {
+		t.Fatal(err)
+	}
+
+	SetStore(s, 0)
+	defer SetStore(nil, 0)
+
+	// act: a cache hit the store doesn't have is backfilled
+	if _, err := getExplorer(context.Background(), key, httpcache.Policy{}, server.URL, req.QueryString(), parseExplorerResponse); err != nil {
+		t.Fatal(err)
+	}
+
+	// assert
+	if got := storedWhite(); got != 1 {
+		t.Fatalf("backfilled white want: 1 got: %d", got)
+	}
+
+	// act: a stale response is served while the background refresh records the new one
+	response, err := getExplorer(context.Background(), key, revalidate, server.URL, req.QueryString(), parseExplorerResponse)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// assert
+	if response.White != 1 {
+		t.Errorf("served white want: 1 got: %d", response.White)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for storedWhite() != 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("refreshed white want: 2 got: %d", storedWhite())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
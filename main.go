@@ -8,8 +8,14 @@ import (
 	"os"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/alecthomas/kong"
+
+	"automock/config"
+	"automock/httpcache"
 	"automock/lichess"
+	"automock/store"
 	"automock/utils"
 )
 
@@ -20,22 +26,84 @@ const (
 
 func main() {
 	/*
-			TODO: 1. Create REPL for stdin/stdout to accept UCI commands and write back status updates
-			TODO: 2. Process UCI command: see file uci_to_implement_for_human_engine.txt
-			TODO: 3. Store Lichess API results in a DB with a timestamp (to detect stale results), and query parameters.
-			TODO:    This will prevent us from querying Lichess too frequently for the same data.
-			TODO: 4. On "go <args>" UCI command, we should be able to query the database and Lichess to get a list of MultiPV moves.
-			TODO:	 We might need to add a UCI option (setoption <name> value <value>) about the "go <args>" behavior.
-			TODO: 	 Originally, it would do the math and return a move according to the distribution; however, it also seems useful
-		    TODO:    to return a list of moves based on popularity when MultiPV > 1.
+		TODO: 1. Create REPL for stdin/stdout to accept UCI commands and write back status updates
+		TODO: 2. Process UCI command: see file uci_to_implement_for_human_engine.txt
 	*/
 
 	//fen := "r1bqkb1r/ppp2ppp/2n2n2/1B1pp3/4P3/P1N2N2/1PPP1PPP/R1BQK2R b KQkq - 1 5" // Gunsberg
 	//fen := "r1bqkb1r/ppp2ppp/2n2n2/1B2N3/4p3/P1N5/1PPP1PPP/R1BQK2R b KQkq - 0 6" // Gunsberg
 	//fen := "rnbqkb1r/1p2pppp/p2p1n2/8/3NP3/2N5/PPP2PPP/R1BQKB1R w KQkq - 0 6" // Najdorf
 
+	var cli struct {
+		Config string `help:"Path to the config file." env:"AUTOMOCK_CONFIG" type:"path"`
+
+		UCI  uciCmd `cmd:"" default:"1" help:"Run the UCI engine on stdin/stdout (default)."`
+		Book struct {
+			Export bookExportCmd `cmd:"" help:"Write the opening explorer tree to a Polyglot book."`
+		} `cmd:"" help:"Polyglot book tools."`
+		PGN struct {
+			Ingest pgnIngestCmd `cmd:"" help:"Aggregate PGN files into a database for the PGN_Database option."`
+		} `cmd:"" name:"pgn" help:"PGN database tools."`
+		Store struct {
+			Ls    storeLsCmd    `cmd:"" help:"List the stored explorer responses."`
+			Purge storePurgeCmd `cmd:"" help:"Delete stored explorer responses by source and age."`
+		} `cmd:"" help:"Explorer response store tools."`
+		Cache struct {
+			Stats   cacheStatsCmd   `cmd:"" help:"Count the cached responses and their size by host and source."`
+			Ls      cacheLsCmd      `cmd:"" help:"List the cached responses."`
+			Show    cacheShowCmd    `cmd:"" help:"Decode the cached explorer, cloud eval and chessdb responses for a position."`
+			Purge   cachePurgeCmd   `cmd:"" help:"Delete cached responses by source and age."`
+			Export  cacheExportCmd  `cmd:"" help:"Write the cache to an archive."`
+			Import  cacheImportCmd  `cmd:"" help:"Add the responses in an archive written by 'cache export' to the cache."`
+			Migrate cacheMigrateCmd `cmd:"" help:"Re-key a cache directory written by older versions."`
+		} `cmd:"" help:"HTTP cache tools."`
+	}
+	kctx := kong.Parse(&cli, kong.Name("automock"), kong.Description("A UCI engine that plays like the humans in the Lichess opening explorer."))
+
+	cfg, err := config.Load(cli.Config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+
+	if err := utils.SetLogFile(cfg.LogFile); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+
+	lichess.SetAPIToken(cfg.LichessAPIToken)
+	httpcache.SetCacheDir(cfg.CacheDir)
+	httpcache.SetOffline(cfg.Offline)
+
+	if err := kctx.Run(cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+}
+
+type uciCmd struct{}
+
+func (c uciCmd) Run(cfg config.Config) error {
+	if s := openStore(cfg); s != nil {
+		defer s.Close()
+	}
+	utils.Log("UCI Engine Started")
 	uciWriteLine(fmt.Sprintf("%s %s", EngineName, Version))
-	uciLoop()
+	uciLoop(cfg)
+	return nil
+}
+
+// openStore opens the store and hands it to the lichess package. The store is optional: if it can't be
+// opened, e.g. because another instance has it, requests go to the file cache and network as before.
+func openStore(cfg config.Config) *store.Store {
+	s, err := store.Open(cfg.StoreFile)
+	if err != nil {
+		utils.Log(fmt.Sprintf("store disabled: %s", err.Error()))
+		return nil
+	}
+
+	lichess.SetStore(s, time.Duration(cfg.StoreMaxAgeDays)*24*time.Hour)
+	return s
 }
 
 var stdoutMutex sync.Mutex
@@ -57,11 +125,11 @@ func uciWriteLine(line string) {
 	stdoutMutex.Unlock()
 }
 
-func uciLoop() {
+func uciLoop(cfg config.Config) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	engine := NewEngine()
+	engine := NewEngine(cfg)
 
 	c := make(chan string, 512)
 
@@ -96,71 +164,31 @@ func uciLoop() {
 	wg.Wait()
 }
 
-func getSuggestedMove(resp lichess.OpeningExplorerResponse) lichess.OpeningExplorerMove {
-	var sumMoveTotals int
-
-	type Range struct {
-		Lower int
-		Upper int
+// sampleIndex picks an index with probability proportional to its weight. It returns -1 if all
+// weights are 0.
+func sampleIndex(weights []float64, rnd *rand.Rand) int {
+	var sumWeights float64
+	for _, weight := range weights {
+		sumWeights += weight
 	}
 
-	ranges := make([]Range, len(resp.Moves))
-
-	for i, move := range resp.Moves {
-		moveTotal := move.Total()
-
-		ranges[i] = Range{Lower: sumMoveTotals, Upper: sumMoveTotals + moveTotal}
-
-		sumMoveTotals += moveTotal
-
-		//fmt.Printf("Move: %-7s Games: %11s Popularity: %5.1f%% White: %5.1f%% Draw: %5.1f%% Black: %5.1f%%\n",
-		//	move.SAN,
-		//	commas.Int(moveTotal),
-		//	float64(moveTotal)/float64(sumMoveTotals)*100,
-		//	float64(move.White)/float64(moveTotal)*100,
-		//	float64(move.Draws)/float64(moveTotal)*100,
-		//	float64(move.Black)/float64(moveTotal)*100,
-		//)
+	if sumWeights == 0 {
+		return -1
 	}
 
-	// TODO
-	if sumMoveTotals == 0 {
-		return lichess.OpeningExplorerMove{SAN: "0000", UCI: "0000"}
+	n := rnd.Float64() * sumWeights
+	var upper float64
+	for i, weight := range weights {
+		upper += weight
+		if weight > 0 && n < upper {
+			return i
+		}
 	}
-
-	getRandomMove := func() int {
-		n := rand.Intn(sumMoveTotals)
-		for i, r := range ranges {
-			if n >= r.Lower && n < r.Upper {
-				return i
-			}
+	// float rounding can leave n == sumWeights; take the last index that can be chosen
+	for i := len(weights) - 1; i >= 0; i-- {
+		if weights[i] > 0 {
+			return i
 		}
-		panic(fmt.Errorf("couldn't find entry that satisfied n=%d sumMoveTotals=%d", n, sumMoveTotals))
 	}
-
-	//const totalSimulationRuns = 1_000_000
-	//simulationResults := make(map[string]int)
-	//for i := 0; i < totalSimulationRuns; i++ {
-	//	idx := getRandomMove()
-	//	san := resp.Moves[idx].SAN
-	//	simulationResults[san] += 1
-	//}
-	//
-	//for i, move := range resp.Moves {
-	//	r := ranges[i]
-	//	moveTotal := r.Upper - r.Lower
-	//
-	//	actualPopularity := float64(moveTotal) / float64(sumMoveTotals) * 100
-	//	simulatedPopularity := float64(simulationResults[move.SAN]) / totalSimulationRuns * 100
-	//
-	//	fmt.Printf("Move: %-7s Act. Popularity: %5.2f%% Sim. Popularity: %5.2f%% Delta: %5.2f%%\n",
-	//		move.SAN,
-	//		actualPopularity,
-	//		simulatedPopularity,
-	//		math.Abs(actualPopularity-simulatedPopularity),
-	//	)
-	//}
-
-	randomMoveIdx := getRandomMove()
-	return resp.Moves[randomMoveIdx]
+	panic(fmt.Errorf("couldn't find entry that satisfied n=%f sumWeights=%f", n, sumWeights))
 }
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+const (
+	MoveSourceBook      = "book"
+	MoveSourceExplorer  = "explorer"
+	MoveSourceEngine    = "engine"
+	MoveSourceCloudEval = "cloud_eval"
+	MoveSourceChessDB   = "chessdb"
+	MoveSourceRandom    = "random"
+)
+
+var validMoveSources = []string{MoveSourceBook, MoveSourceExplorer, MoveSourceEngine, MoveSourceCloudEval, MoveSourceChessDB, MoveSourceRandom}
+
+// Candidate is a move a MoveSource would play.
+type Candidate struct {
+	UCI string
+	// Weight is relative to the source's other candidates.
+	Weight float64
+	// Source is where the move came from, e.g. "lichess_masters", reported in "info string movesource".
+	Source string
+}
+
+// MoveSource proposes moves for the position being searched. Candidates should return when ctx is done.
+type MoveSource interface {
+	Candidates(ctx context.Context) ([]Candidate, error)
+}
+
+// movePipeline is a Move_Sources value: stages separated by '>', each a comma separated list of sources
+// with optional weights, e.g. "book>explorer:80,engine:20>random". The first stage with a move wins.
+// Within a stage, a source is picked in proportion to its weight from the sources that have moves.
+type movePipeline []moveStage
+
+type moveStage []weightedSource
+
+type weightedSource struct {
+	Name   string
+	Weight int
+}
+
+func parseMovePipeline(value string) (movePipeline, error) {
+	var pipeline movePipeline
+	seen := make(map[string]bool)
+
+	for _, stageValue := range strings.Split(value, ">") {
+		var stage moveStage
+		for _, item := range strings.Split(stageValue, ",") {
+			name, weightValue, hasWeight := strings.Cut(strings.TrimSpace(item), ":")
+
+			canonical, err := comboValue(validMoveSources, strings.TrimSpace(name))
+			if err != nil {
+				return nil, err
+			}
+			if seen[canonical] {
+				return nil, xerrors.Errorf("'%s' is listed more than once", canonical)
+			}
+			seen[canonical] = true
+
+			weight := 1
+			if hasWeight {
+				weight, err = strconv.Atoi(strings.TrimSpace(weightValue))
+				if err != nil || weight < 0 {
+					return nil, xerrors.Errorf("weight '%s' for %s is not a non-negative integer", weightValue, canonical)
+				}
+			}
+
+			stage = append(stage, weightedSource{Name: canonical, Weight: weight})
+		}
+		pipeline = append(pipeline, stage)
+	}
+
+	return pipeline, nil
+}
+
+func (p movePipeline) String() string {
+	stages := make([]string, len(p))
+	for i, stage := range p {
+		items := make([]string, len(stage))
+		for j, source := range stage {
+			items[j] = source.Name
+			if len(stage) > 1 || source.Weight != 1 {
+				items[j] += ":" + strconv.Itoa(source.Weight)
+			}
+		}
+		stages[i] = strings.Join(items, ",")
+	}
+	return strings.Join(stages, ">")
+}
+
+type sourceResult struct {
+	candidates []Candidate
+	err        error
+	done       chan struct{}
+}
+
+// choose asks every source in the pipeline for candidates at once, then goes through the stages in order,
+// waiting only for the sources of the stage it's on. Once a move is chosen the other sources are canceled.
+// report is called with the error of each source whose result was needed.
+func (p movePipeline) choose(ctx context.Context, sources map[string]MoveSource, rnd *rand.Rand, report func(name string, err error)) (Candidate, bool) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(map[string]*sourceResult)
+	for _, stage := range p {
+		for _, ws := range stage {
+			source, ok := sources[ws.Name]
+			if !ok {
+				continue
+			}
+
+			r := &sourceResult{done: make(chan struct{})}
+			results[ws.Name] = r
+
+			go func() {
+				defer close(r.done)
+				r.candidates, r.err = source.Candidates(ctx)
+			}()
+		}
+	}
+
+	for _, stage := range p {
+		var (
+			stageCandidates [][]Candidate
+			weights         []float64
+		)
+
+		for _, ws := range stage {
+			r, ok := results[ws.Name]
+			if !ok {
+				continue
+			}
+
+			<-r.done
+			if r.err != nil {
+				report(ws.Name, r.err)
+				continue
+			}
+
+			stageCandidates = append(stageCandidates, r.candidates)
+			if candidateWeight(r.candidates) > 0 {
+				weights = append(weights, float64(ws.Weight))
+			} else {
+				weights = append(weights, 0)
+			}
+		}
+
+		idx := sampleIndex(weights, rnd)
+		if idx < 0 {
+			continue
+		}
+
+		candidates := stageCandidates[idx]
+		candidateWeights := make([]float64, len(candidates))
+		for i, candidate := range candidates {
+			candidateWeights[i] = candidate.Weight
+		}
+
+		return candidates[sampleIndex(candidateWeights, rnd)], true
+	}
+
+	return Candidate{}, false
+}
+
+func candidateWeight(candidates []Candidate) float64 {
+	var sum float64
+	for _, candidate := range candidates {
+		sum += candidate.Weight
+	}
+	return sum
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"automock/bitboard"
+	"automock/lichess"
+)
+
+func TestParseMovePipeline(t *testing.T) {
+	cases := []struct {
+		name    string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{name: "default", value: "book>explorer>engine>random", want: "book>explorer>engine>random"},
+		{name: "blend", value: "book > Explorer:80, engine:20 > random", want: "book>explorer:80,engine:20>random"},
+		{name: "blend default weights", value: "explorer,cloud_eval", want: "explorer:1,cloud_eval:1"},
+		{name: "single weight kept", value: "explorer:5", want: "explorer:5"},
+		{name: "unknown source", value: "book>oracle", wantErr: true},
+		{name: "repeated source", value: "explorer>engine>explorer", wantErr: true},
+		{name: "negative weight", value: "explorer:-1,engine", wantErr: true},
+		{name: "empty", value: "", wantErr: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// act
+			pipeline, err := parseMovePipeline(c.value)
+
+			// assert
+			if (err != nil) != c.wantErr {
+				t.Fatalf("wantErr: %v got: %v", c.wantErr, err)
+			}
+			if err == nil && c.want != pipeline.String() {
+				t.Errorf("want: %q got: %q", c.want, pipeline.String())
+			}
+		})
+	}
+}
+
+// fakeMoveSource returns its candidates after delay, or gives up when ctx is done.
+type fakeMoveSource struct {
+	candidates []Candidate
+	err        error
+	delay      time.Duration
+}
+
+func (s fakeMoveSource) Candidates(ctx context.Context) ([]Candidate, error) {
+	select {
+	case <-time.After(s.delay):
+		return s.candidates, s.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func TestMovePipeline_Choose(t *testing.T) {
+	sources := map[string]MoveSource{
+		MoveSourceBook:      fakeMoveSource{},
+		MoveSourceExplorer:  fakeMoveSource{candidates: []Candidate{{UCI: "e2e4", Weight: 3, Source: "lichess_data"}, {UCI: "d2d4", Weight: 1, Source: "lichess_data"}}},
+		MoveSourceEngine:    fakeMoveSource{candidates: []Candidate{{UCI: "g1f3", Weight: 1, Source: "external_engine"}}},
+		MoveSourceCloudEval: fakeMoveSource{err: errors.New("not found")},
+		// the random source is slow so a test hangs if the pipeline waits for it needlessly
+		MoveSourceRandom: fakeMoveSource{candidates: []Candidate{{UCI: "a2a3", Weight: 1, Source: "random_legal_move"}}, delay: time.Hour},
+	}
+
+	cases := []struct {
+		name       string
+		pipeline   string
+		want       map[string]bool
+		wantReport string
+	}{
+		{name: "first stage with moves wins", pipeline: "book>explorer>engine>random", want: map[string]bool{"e2e4": true, "d2d4": true}},
+		{name: "fallback", pipeline: "book>engine>random", want: map[string]bool{"g1f3": true}},
+		{name: "blend", pipeline: "explorer:50,engine:50>random", want: map[string]bool{"e2e4": true, "d2d4": true, "g1f3": true}},
+		{name: "zero weight never plays", pipeline: "explorer:1,engine:0>random", want: map[string]bool{"e2e4": true, "d2d4": true}},
+		{name: "error reported and skipped", pipeline: "cloud_eval>engine>random", want: map[string]bool{"g1f3": true}, wantReport: "cloud_eval: not found"},
+		{name: "nothing", pipeline: "book", want: map[string]bool{"": true}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// arrange
+			pipeline, err := parseMovePipeline(c.pipeline)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rnd := rand.New(rand.NewSource(1))
+
+			got := make(map[string]bool)
+			var report string
+
+			// act
+			for i := 0; i < 100; i++ {
+				chosen, _ := pipeline.choose(context.Background(), sources, rnd, func(name string, err error) {
+					report = fmt.Sprintf("%s: %s", name, err.Error())
+				})
+				got[chosen.UCI] = true
+			}
+
+			// assert
+			if fmt.Sprint(c.want) != fmt.Sprint(got) {
+				t.Errorf("want: %v got: %v", c.want, got)
+			}
+			if c.wantReport != report {
+				t.Errorf("report want: %q got: %q", c.wantReport, report)
+			}
+		})
+	}
+}
+
+func TestParseEngineInfo(t *testing.T) {
+	cases := []struct {
+		name   string
+		line   string
+		want   engineLine
+		wantOK bool
+	}{
+		{name: "cp", line: "info depth 20 seldepth 28 multipv 2 score cp -31 nodes 100 pv e7e5 g1f3", want: engineLine{MultiPV: 2, Depth: 20, Score: -31, CP: -31, Move: "e7e5"}, wantOK: true},
+		{name: "mate", line: "info depth 12 score mate 3 pv d1h5 g7g6", want: engineLine{MultiPV: 1, Depth: 12, Score: mateScore - 5, Mate: 3, Move: "d1h5"}, wantOK: true},
+		{name: "mated", line: "info depth 12 score mate -2 pv e8e7", want: engineLine{MultiPV: 1, Depth: 12, Score: -mateScore + 4, Mate: -2, Move: "e8e7"}, wantOK: true},
+		{name: "no pv", line: "info depth 20 currmove e2e4 currmovenumber 1"},
+		{name: "string", line: "info string NNUE evaluation using nn.nnue"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// act
+			got, ok := parseEngineInfo(c.line)
+
+			// assert
+			if c.wantOK != ok || c.want != got {
+				t.Errorf("want: %+v, %v got: %+v, %v", c.want, c.wantOK, got, ok)
+			}
+		})
+	}
+}
+
+func TestScoreWeights(t *testing.T) {
+	// act
+	got := scoreWeights([]int{20, 20, -80})
+
+	// assert
+	want := []float64{1, 1, math.Exp(-1)}
+	for i := range want {
+		if math.Abs(want[i]-got[i]) > 1e-9 {
+			t.Fatalf("want: %v got: %v", want, got)
+		}
+	}
+}
+
+func TestCloudEvalCandidates(t *testing.T) {
+	cases := []struct {
+		name      string
+		fen       string
+		cloudEval lichess.CloudEvalResponse
+		want      []Candidate
+	}{
+		{
+			name:      "castling",
+			fen:       "r3k2r/pppq1ppp/2n2n2/3pp3/3PP3/2N2N2/PPPQ1PPP/R3K2R w KQkq - 0 1",
+			cloudEval: lichess.CloudEvalResponse{PVs: []lichess.CloudEvalPV{{MovesUCI: "e1h1 e8a8", CP: 20}, {MovesUCI: "e1a1 e8h8", CP: 20}}},
+			want:      []Candidate{{UCI: "e1g1", Weight: 1, Source: "cloud_eval"}, {UCI: "e1c1", Weight: 1, Source: "cloud_eval"}},
+		},
+		{
+			name:      "black to move",
+			fen:       "r3k2r/pppq1ppp/2n2n2/3pp3/3PP3/2N2N2/PPPQ1PPP/R3K2R b KQkq - 0 1",
+			cloudEval: lichess.CloudEvalResponse{PVs: []lichess.CloudEvalPV{{MovesUCI: "e8a8", CP: -20}, {MovesUCI: "h7h6", CP: 80}}},
+			want:      []Candidate{{UCI: "e8c8", Weight: 1, Source: "cloud_eval"}, {UCI: "h7h6", Weight: math.Exp(-1), Source: "cloud_eval"}},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// arrange
+			b, err := bitboard.ParseFEN(c.fen)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// act
+			got := cloudEvalCandidates(b, c.cloudEval)
+
+			// assert
+			if len(c.want) != len(got) {
+				t.Fatalf("want: %+v got: %+v", c.want, got)
+			}
+			for i := range c.want {
+				if c.want[i].UCI != got[i].UCI || math.Abs(c.want[i].Weight-got[i].Weight) > 1e-9 {
+					t.Errorf("want: %+v got: %+v", c.want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestMateToCP(t *testing.T) {
+	cases := []struct {
+		name string
+		mate int
+		want int
+	}{
+		// chessdb's scores for the same mates
+		{name: "mates", mate: 1, want: 29999},
+		{name: "mate in 2", mate: 2, want: 29997},
+		{name: "mated next turn", mate: -1, want: -29998},
+		{name: "mated in 2", mate: -2, want: -29996},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// act
+			got := mateToCP(c.mate)
+
+			// assert
+			if c.want != got {
+				t.Errorf("want: %d got: %d", c.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,389 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"automock/bitboard"
+	"automock/chessdb"
+	"automock/extengine"
+	"automock/lichess"
+	"automock/polyglot"
+	"automock/utils"
+)
+
+const (
+	// mateScore is the centipawn value of mate on the board. chessdb scores a mate n plies away as
+	// 30000-n, and being mated n plies away as -(30000-n).
+	mateScore = 30000
+
+	// scoreWeightScale is the centipawn loss that makes a move e times less likely than the best move,
+	// for the sources that rank moves by evaluation.
+	scoreWeightScale = 100
+)
+
+// scoreWeights weights moves by their score relative to the best, so equal moves are played equally often
+// and a move that loses scoreWeightScale centipawns is e times less likely.
+func scoreWeights(scores []int) []float64 {
+	return scaledScoreWeights(scores, scoreWeightScale)
+}
+
+// scaledScoreWeights is scoreWeights with a move that loses scale centipawns e times less likely.
+func scaledScoreWeights(scores []int, scale int) []float64 {
+	best := math.MinInt
+	for _, score := range scores {
+		if score > best {
+			best = score
+		}
+	}
+
+	weights := make([]float64, len(scores))
+	for i, score := range scores {
+		weights[i] = math.Exp(float64(score-best) / float64(scale))
+	}
+	return weights
+}
+
+// mateToCP converts a mate in n moves to a centipawn score on chessdb's scale, negative n being mated. Mate
+// in n is 2n-1 plies away, being mated in n is 2n plies away.
+func mateToCP(mate int) int {
+	if mate > 0 {
+		return mateScore - (2*mate - 1)
+	}
+	return -mateScore - 2*mate
+}
+
+// bookMoveSource plays the moves in the Book_File book, weighted by the book's weights.
+type bookMoveSource struct {
+	book  *polyglot.Book
+	board bitboard.Board
+}
+
+func (s bookMoveSource) Candidates(ctx context.Context) ([]Candidate, error) {
+	if s.book == nil {
+		return nil, nil
+	}
+
+	var candidates []Candidate
+	for _, bookMove := range s.book.Lookup(s.board) {
+		candidates = append(candidates, Candidate{UCI: bookMove.UCI, Weight: float64(bookMove.Weight), Source: "book"})
+	}
+	return candidates, nil
+}
+
+// explorerMoveSource plays the explorer moves, weighted by the Move_Selection policy. The response is kept
+// for the MultiPV output.
+type explorerMoveSource struct {
+	settings searchSettings
+	side     bitboard.Color
+	skipped  *skippedSources
+	rnd      *rand.Rand
+
+	mtx  sync.Mutex
+	resp lichess.OpeningExplorerResponse
+}
+
+func (s *explorerMoveSource) Candidates(ctx context.Context) ([]Candidate, error) {
+	resp, source, err := searchLichess(ctx, s.settings, s.rnd, s.skipped)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mtx.Lock()
+	s.resp = resp
+	s.mtx.Unlock()
+
+	return explorerCandidates(resp, s.settings.policy, s.side, source), nil
+}
+
+func (s *explorerMoveSource) response() lichess.OpeningExplorerResponse {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.resp
+}
+
+func explorerCandidates(resp lichess.OpeningExplorerResponse, policy SelectionPolicy, side bitboard.Color, source string) []Candidate {
+	weights := policy.Weights(resp.Moves, side)
+
+	var candidates []Candidate
+	for i, move := range resp.Moves {
+		if weights[i] > 0 {
+			candidates = append(candidates, Candidate{UCI: move.UCI, Weight: weights[i], Source: source})
+		}
+	}
+	return candidates
+}
+
+// engineMoveSource plays the external engine's lines. With ExternalEngine_MultiPV above 1 the lines are
+// weighted by their scores. The lines are kept for the evaluation.
+type engineMoveSource struct {
+	extEngine *extengine.ExternalEngine
+	job       extengine.AnalysisRequest
+	// weightScale, if set, replaces scoreWeightScale for the lines
+	weightScale int
+
+	once       sync.Once
+	candidates []Candidate
+	err        error
+
+	mtx      sync.Mutex
+	analysed []engineLine
+	endedAt  time.Time
+}
+
+// Candidates runs the analysis the first time it's called. Later calls, like the blunder guard's when
+// the engine is also a move source, wait for that analysis and get the same candidates.
+func (s *engineMoveSource) Candidates(ctx context.Context) ([]Candidate, error) {
+	s.once.Do(func() {
+		s.candidates, s.err = s.analyse(ctx)
+	})
+	return s.candidates, s.err
+}
+
+func (s *engineMoveSource) analyse(ctx context.Context) ([]Candidate, error) {
+	if s.extEngine == nil {
+		return nil, nil
+	}
+
+	job := s.job
+
+	responses := make(chan extengine.AnalysisResponse, bufferedChannelSize)
+
+	// buffered so Analyze doesn't block (holding its lock) if we've already given up waiting
+	jobStarted := make(chan struct{}, 1)
+
+	go func() {
+		analysisStream, err := s.extEngine.Analyze(ctx, job, jobStarted)
+		if err != nil {
+			utils.Log(fmt.Sprintf("external engine: error: %s", err.Error()))
+		}
+
+		go func() {
+			defer func() {
+				responses <- extengine.AnalysisResponse{RequestID: job.RequestID, End: true}
+			}()
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case lineItem, ok := <-analysisStream:
+					if !ok {
+						return
+					}
+					responses <- extengine.AnalysisResponse{RequestID: job.RequestID, Line: lineItem}
+				}
+			}
+		}()
+	}()
+
+	select {
+	case <-jobStarted:
+		utils.Log(fmt.Sprintf("external engine: received 'job started'"))
+		break
+	case <-ctx.Done():
+		return nil, nil
+	}
+
+	var bestMove string
+	lines := make(map[int]engineLine)
+
+	for resp := range responses {
+		if resp.End {
+			utils.Log(fmt.Sprintf("external engine: received 'job ended'"))
+			break
+		}
+
+		if fields := strings.Fields(resp.Line); len(fields) > 1 && fields[0] == "bestmove" {
+			bestMove = fields[1]
+			continue
+		}
+
+		if line, ok := parseEngineInfo(resp.Line); ok {
+			lines[line.MultiPV] = line
+		}
+	}
+
+	if len(lines) == 0 {
+		if bestMove == "" || bestMove == nullMove || bestMove == "(none)" {
+			return nil, nil
+		}
+		return []Candidate{{UCI: bestMove, Weight: 1, Source: "external_engine"}}, nil
+	}
+
+	multiPVs := make([]int, 0, len(lines))
+	for multiPV := range lines {
+		multiPVs = append(multiPVs, multiPV)
+	}
+	sort.Ints(multiPVs)
+
+	analysed := make([]engineLine, len(multiPVs))
+	scores := make([]int, len(multiPVs))
+	for i, multiPV := range multiPVs {
+		analysed[i] = lines[multiPV]
+		scores[i] = lines[multiPV].Score
+	}
+
+	s.mtx.Lock()
+	s.analysed = analysed
+	s.endedAt = time.Now()
+	s.mtx.Unlock()
+
+	weightScale := s.weightScale
+	if weightScale == 0 {
+		weightScale = scoreWeightScale
+	}
+	weights := scaledScoreWeights(scores, weightScale)
+
+	candidates := make([]Candidate, len(multiPVs))
+	for i, multiPV := range multiPVs {
+		candidates[i] = Candidate{UCI: lines[multiPV].Move, Weight: weights[i], Source: "external_engine"}
+	}
+	return candidates, nil
+}
+
+// lines returns the engine's last lines and when the analysis ended.
+func (s *engineMoveSource) lines() ([]engineLine, time.Time) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.analysed, s.endedAt
+}
+
+// engineLine is the first move of an "info ... pv" line and its score for the side to move. Score has mates
+// converted to centipawns; CP and Mate are the score as reported.
+type engineLine struct {
+	MultiPV int
+	Depth   int
+	Score   int
+	CP      int
+	Mate    int
+	Move    string
+}
+
+func parseEngineInfo(line string) (engineLine, bool) {
+	parts := strings.Fields(line)
+	if len(parts) == 0 || parts[0] != "info" {
+		return engineLine{}, false
+	}
+
+	result := engineLine{MultiPV: 1}
+	for i := 1; i < len(parts)-1; i++ {
+		switch parts[i] {
+		case "multipv":
+			if n, err := strconv.Atoi(parts[i+1]); err == nil {
+				result.MultiPV = n
+			}
+		case "depth":
+			if n, err := strconv.Atoi(parts[i+1]); err == nil {
+				result.Depth = n
+			}
+		case "score":
+			if i+2 >= len(parts) {
+				continue
+			}
+			n, err := strconv.Atoi(parts[i+2])
+			if err != nil {
+				continue
+			}
+			switch parts[i+1] {
+			case "cp":
+				result.Score, result.CP = n, n
+			case "mate":
+				result.Score, result.Mate = mateToCP(n), n
+			}
+		case "pv":
+			result.Move = parts[i+1]
+			return result, true
+		}
+	}
+
+	return engineLine{}, false
+}
+
+// cloudEvalMoveSource plays the first moves of the Lichess cloud eval lines, weighted by their scores.
+type cloudEvalMoveSource struct {
+	board bitboard.Board
+}
+
+func (s cloudEvalMoveSource) Candidates(ctx context.Context) ([]Candidate, error) {
+	cloudEval, err := lichess.GetCloudEval(ctx, s.board.FEN(), cloudEvalMultiPV)
+	if err != nil {
+		return nil, err
+	}
+
+	return cloudEvalCandidates(s.board, cloudEval), nil
+}
+
+func cloudEvalCandidates(b bitboard.Board, cloudEval lichess.CloudEvalResponse) []Candidate {
+	moves := make([]string, 0, len(cloudEval.PVs))
+	scores := make([]int, 0, len(cloudEval.PVs))
+	for _, pv := range cloudEval.PVs {
+		score := pv.CP
+		if pv.Mate != 0 {
+			score = mateToCP(pv.Mate)
+		}
+		// cloud evals are from white's point of view
+		if b.ActiveColor == bitboard.Black {
+			score = -score
+		}
+
+		// and write castling as the king taking its own rook
+		moves = append(moves, b.NormalizeCastling(strings.Split(pv.MovesUCI, " ")[0]))
+		scores = append(scores, score)
+	}
+
+	return scoredCandidates(moves, scores, "cloud_eval")
+}
+
+// chessDBMoveSource plays the moves chessdb has scored, weighted by their scores.
+type chessDBMoveSource struct {
+	fen string
+}
+
+func (s chessDBMoveSource) Candidates(ctx context.Context) ([]Candidate, error) {
+	queryAll, err := chessdb.QueryAll(ctx, s.fen)
+	if err != nil {
+		return nil, err
+	}
+
+	moves := make([]string, 0, len(queryAll.Moves))
+	scores := make([]int, 0, len(queryAll.Moves))
+	for _, move := range queryAll.Moves {
+		moves = append(moves, move.UCI)
+		scores = append(scores, move.Score)
+	}
+
+	return scoredCandidates(moves, scores, "chessdb"), nil
+}
+
+func scoredCandidates(moves []string, scores []int, source string) []Candidate {
+	weights := scoreWeights(scores)
+
+	candidates := make([]Candidate, len(moves))
+	for i, move := range moves {
+		candidates[i] = Candidate{UCI: move, Weight: weights[i], Source: source}
+	}
+	return candidates
+}
+
+// randomMoveSource plays any legal move.
+type randomMoveSource struct {
+	board bitboard.Board
+}
+
+func (s randomMoveSource) Candidates(ctx context.Context) ([]Candidate, error) {
+	legalMoves := s.board.LegalMoves()
+
+	candidates := make([]Candidate, len(legalMoves))
+	for i, move := range legalMoves {
+		candidates[i] = Candidate{UCI: move, Weight: 1, Source: "random_legal_move"}
+	}
+	return candidates, nil
+}
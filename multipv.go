@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"automock/commas"
+	"automock/lichess"
+)
+
+// multiPVInfo returns an "info multipv N" line for the chosen move, as multipv 1, and for the most popular
+// of the other explorer moves, up to multiPV lines. Each explorer move is followed by an "info string" line
+// with its game statistics.
+func multiPVInfo(explorer lichess.OpeningExplorerResponse, chosen string, evals moveEvaluations, showWDL bool, multiPV int, ms int64) string {
+	moves := make([]lichess.OpeningExplorerMove, 0, len(explorer.Moves)+1)
+	moves = append(moves, lichess.OpeningExplorerMove{UCI: chosen})
+
+	var sumMoveTotals int
+	for _, move := range explorer.Moves {
+		sumMoveTotals += move.Total()
+
+		if move.UCI == chosen {
+			moves[0] = move
+			continue
+		}
+		moves = append(moves, move)
+	}
+
+	others := moves[1:]
+	sort.SliceStable(others, func(i, j int) bool {
+		return others[i].Total() > others[j].Total()
+	})
+
+	if multiPV > len(moves) {
+		multiPV = len(moves)
+	}
+
+	var sb strings.Builder
+	for i := 0; i < multiPV; i++ {
+		move := moves[i]
+
+		ev, ok := evals.best(move.UCI)
+		depth, score := evalInfo(ev, ok, showWDL)
+
+		sb.WriteString(fmt.Sprintf("info depth %d multipv %d%s time %d pv %s\n", depth, i+1, score, ms, move.UCI))
+
+		// a chosen move that isn't in the explorer has no games to report
+		if move.SAN == "" {
+			continue
+		}
+
+		moveTotal := move.Total()
+
+		sb.WriteString(fmt.Sprintf("info string multipv %d move %s games %s popularity %.1f%% white %.1f%% draws %.1f%% black %.1f%%\n",
+			i+1,
+			move.SAN,
+			commas.Int(moveTotal),
+			percent(moveTotal, sumMoveTotals),
+			percent(move.White, moveTotal),
+			percent(move.Draws, moveTotal),
+			percent(move.Black, moveTotal),
+		))
+	}
+
+	return sb.String()
+}
+
+func percent(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) / float64(total) * 100
+}
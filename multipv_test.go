@@ -0,0 +1,110 @@
+package main
+
+import (
+	"testing"
+
+	"automock/lichess"
+)
+
+func TestMultiPVInfo(t *testing.T) {
+	explorer := lichess.OpeningExplorerResponse{
+		Moves: []lichess.OpeningExplorerMove{
+			{UCI: "c2c4", SAN: "c4", White: 200, Draws: 100, Black: 100},
+			{UCI: "d2d4", SAN: "d4", White: 500, Draws: 300, Black: 200},
+			{UCI: "e2e4", SAN: "e4", White: 300, Draws: 150, Black: 150},
+		},
+	}
+
+	cases := []struct {
+		name     string
+		explorer lichess.OpeningExplorerResponse
+		chosen   string
+		evals    moveEvaluations
+		showWDL  bool
+		multiPV  int
+		want     string
+	}{
+		{
+			name:     "ranked by popularity",
+			explorer: explorer,
+			chosen:   "d2d4",
+			evals:    moveEvaluations{"d2d4": {{CP: 30, Depth: 25}}},
+			multiPV:  2,
+			want: "info depth 25 multipv 1 score cp 30 time 5 pv d2d4\n" +
+				"info string multipv 1 move d4 games 1,000 popularity 50.0% white 50.0% draws 30.0% black 20.0%\n" +
+				"info depth 18 multipv 2 time 5 pv e2e4\n" +
+				"info string multipv 2 move e4 games 600 popularity 30.0% white 50.0% draws 25.0% black 25.0%\n",
+		},
+		{
+			name:     "multipv larger than moves",
+			explorer: explorer,
+			chosen:   "d2d4",
+			multiPV:  5,
+			want: "info depth 18 multipv 1 time 5 pv d2d4\n" +
+				"info string multipv 1 move d4 games 1,000 popularity 50.0% white 50.0% draws 30.0% black 20.0%\n" +
+				"info depth 18 multipv 2 time 5 pv e2e4\n" +
+				"info string multipv 2 move e4 games 600 popularity 30.0% white 50.0% draws 25.0% black 25.0%\n" +
+				"info depth 18 multipv 3 time 5 pv c2c4\n" +
+				"info string multipv 3 move c4 games 400 popularity 20.0% white 50.0% draws 25.0% black 25.0%\n",
+		},
+		{
+			name:     "deepest evaluation",
+			explorer: explorer,
+			chosen:   "d2d4",
+			evals:    moveEvaluations{"d2d4": {{CP: 10, Depth: 20}, {CP: 40, Depth: 30}}},
+			multiPV:  1,
+			want: "info depth 30 multipv 1 score cp 40 time 5 pv d2d4\n" +
+				"info string multipv 1 move d4 games 1,000 popularity 50.0% white 50.0% draws 30.0% black 20.0%\n",
+		},
+		{
+			name:     "mate with wdl",
+			explorer: explorer,
+			chosen:   "d2d4",
+			evals:    moveEvaluations{"d2d4": {{Mate: 3, Depth: 40}}},
+			showWDL:  true,
+			multiPV:  1,
+			want: "info depth 40 multipv 1 score mate 3 wdl 1000 0 0 time 5 pv d2d4\n" +
+				"info string multipv 1 move d4 games 1,000 popularity 50.0% white 50.0% draws 30.0% black 20.0%\n",
+		},
+		{
+			name:     "chosen move isn't the most popular",
+			explorer: explorer,
+			chosen:   "c2c4",
+			evals:    moveEvaluations{"c2c4": {{CP: 20, Depth: 25}}},
+			multiPV:  2,
+			want: "info depth 25 multipv 1 score cp 20 time 5 pv c2c4\n" +
+				"info string multipv 1 move c4 games 400 popularity 20.0% white 50.0% draws 25.0% black 25.0%\n" +
+				"info depth 18 multipv 2 time 5 pv d2d4\n" +
+				"info string multipv 2 move d4 games 1,000 popularity 50.0% white 50.0% draws 30.0% black 20.0%\n",
+		},
+		{
+			name:     "chosen move isn't in the explorer",
+			explorer: explorer,
+			chosen:   "g1f3",
+			evals:    moveEvaluations{"g1f3": {{CP: 25, Depth: 30}}},
+			multiPV:  2,
+			want: "info depth 30 multipv 1 score cp 25 time 5 pv g1f3\n" +
+				"info depth 18 multipv 2 time 5 pv d2d4\n" +
+				"info string multipv 2 move d4 games 1,000 popularity 50.0% white 50.0% draws 30.0% black 20.0%\n",
+		},
+		{
+			name:     "no explorer moves",
+			explorer: lichess.OpeningExplorerResponse{},
+			chosen:   "e2e4",
+			multiPV:  3,
+			want:     "info depth 18 multipv 1 time 5 pv e2e4\n",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// act
+			got := multiPVInfo(c.explorer, c.chosen, c.evals, c.showWDL, c.multiPV, 5)
+
+			// assert
+			if c.want != got {
+				t.Errorf("want:\n%s\ngot:\n%s", c.want, got)
+			}
+		})
+	}
+}
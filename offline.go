@@ -0,0 +1,40 @@
+package main
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+
+	"automock/httpcache"
+)
+
+// skippedSources collects the sources a search went without because it's offline and they weren't
+// cached. The lookups run concurrently, so it's locked.
+type skippedSources struct {
+	mtx     sync.Mutex
+	sources []string
+}
+
+// skip records source if err is an offline cache miss, and reports whether it was. Any other error is
+// left to the caller.
+func (s *skippedSources) skip(source string, err error) bool {
+	if !errors.Is(err, httpcache.ErrNotCached) {
+		return false
+	}
+
+	s.mtx.Lock()
+	s.sources = append(s.sources, source)
+	s.mtx.Unlock()
+
+	return true
+}
+
+func (s *skippedSources) String() string {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	sources := append([]string(nil), s.sources...)
+	sort.Strings(sources)
+	return strings.Join(sources, " ")
+}
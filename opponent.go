@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/xerrors"
+
+	"automock/lichess"
+)
+
+// adaptiveRatingMargin is how far either side of the opponent's rating Adaptive_Rating looks for games.
+const adaptiveRatingMargin = 200
+
+// Opponent is the UCI_Opponent option, "<title> <elo> <computer|human> <name>", e.g.
+// "GM 2800 human Magnus Carlsen" or "none none computer Stockfish".
+type Opponent struct {
+	// Title is empty for "none"
+	Title string
+	// Elo is 0 for "none"
+	Elo      int
+	Computer bool
+	Name     string
+}
+
+func parseOpponent(value string) (Opponent, error) {
+	parts := strings.Fields(value)
+	if len(parts) < 3 {
+		return Opponent{}, xerrors.Errorf("'%s' is not '<title> <elo> <computer|human> <name>'", value)
+	}
+
+	var opponent Opponent
+
+	if !strings.EqualFold(parts[0], "none") {
+		opponent.Title = parts[0]
+	}
+
+	if !strings.EqualFold(parts[1], "none") {
+		elo, err := strconv.Atoi(parts[1])
+		if err != nil || elo < 0 {
+			return Opponent{}, xerrors.Errorf("'%s' is not a rating or 'none'", parts[1])
+		}
+		opponent.Elo = elo
+	}
+
+	switch strings.ToLower(parts[2]) {
+	case "computer":
+		opponent.Computer = true
+	case "human":
+	default:
+		return Opponent{}, xerrors.Errorf("'%s' is not 'computer' or 'human'", parts[2])
+	}
+
+	opponent.Name = strings.Join(parts[3:], " ")
+
+	return opponent, nil
+}
+
+func (o Opponent) String() string {
+	title := o.Title
+	if title == "" {
+		title = "none"
+	}
+	elo := "none"
+	if o.Elo > 0 {
+		elo = strconv.Itoa(o.Elo)
+	}
+	kind := "human"
+	if o.Computer {
+		kind = "computer"
+	}
+	return strings.TrimSpace(fmt.Sprintf("%s %s %s %s", title, elo, kind, o.Name))
+}
+
+// adaptiveRatingWindow returns the rating buckets within adaptiveRatingMargin of elo.
+func adaptiveRatingWindow(elo int) (lichess.Rating, lichess.Rating) {
+	return lichess.RatingBucket(elo - adaptiveRatingMargin), lichess.RatingBucket(elo + adaptiveRatingMargin)
+}
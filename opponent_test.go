@@ -0,0 +1,98 @@
+package main
+
+import (
+	"testing"
+
+	"automock/config"
+)
+
+func TestParseOpponent(t *testing.T) {
+	cases := []struct {
+		name    string
+		value   string
+		want    Opponent
+		wantErr bool
+	}{
+		{name: "titled human", value: "GM 2800 human Magnus Carlsen", want: Opponent{Title: "GM", Elo: 2800, Name: "Magnus Carlsen"}},
+		{name: "untitled computer", value: "none 2250 computer lichess-bot", want: Opponent{Elo: 2250, Computer: true, Name: "lichess-bot"}},
+		{name: "no rating", value: "none none human", want: Opponent{}},
+		{name: "too short", value: "GM 2800", wantErr: true},
+		{name: "bad rating", value: "none strong human someone", wantErr: true},
+		{name: "bad kind", value: "none 1500 robot someone", wantErr: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// act
+			got, err := parseOpponent(c.value)
+
+			// assert
+			if (err != nil) != c.wantErr {
+				t.Fatalf("wantErr: %v got: %v", c.wantErr, err)
+			}
+			if c.want != got {
+				t.Errorf("want: %+v got: %+v", c.want, got)
+			}
+		})
+	}
+}
+
+func TestEngine_RatingBands(t *testing.T) {
+	cases := []struct {
+		name       string
+		options    map[string]string
+		wantBands  string
+		wantReason string
+	}{
+		{
+			name:       "options",
+			wantBands:  "1600,1800,2000,2200,2500",
+			wantReason: "Lichess_Rating_Min/Max",
+		},
+		{
+			name:       "opponent without Adaptive_Rating",
+			options:    map[string]string{"UCI_Opponent": "none 1450 human someone"},
+			wantBands:  "1600,1800,2000,2200,2500",
+			wantReason: "Lichess_Rating_Min/Max",
+		},
+		{
+			name:       "adaptive",
+			options:    map[string]string{"UCI_Opponent": "none 1450 human someone", "Adaptive_Rating": "true"},
+			wantBands:  "1200,1400,1600",
+			wantReason: "Adaptive_Rating opponent 1450",
+		},
+		{
+			name:       "adaptive without a rating",
+			options:    map[string]string{"UCI_Opponent": "none none computer engine", "Adaptive_Rating": "true"},
+			wantBands:  "1600,1800,2000,2200,2500",
+			wantReason: "Lichess_Rating_Min/Max",
+		},
+		{
+			name:       "UCI_LimitStrength wins",
+			options:    map[string]string{"UCI_Opponent": "none 1450 human someone", "Adaptive_Rating": "true", "UCI_LimitStrength": "true", "UCI_Elo": "2000"},
+			wantBands:  "1800,2000",
+			wantReason: "UCI_Elo",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// arrange
+			e := NewEngine(config.Config{})
+			for name, value := range c.options {
+				uciOption, _ := e.findUCIOption(name)
+				if err := uciOption.Set(e, value); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// act
+			ratings, reason := e.ratingBands()
+
+			// assert
+			if c.wantBands != ratings.String() || c.wantReason != reason {
+				t.Errorf("want: %s, %s got: %s, %s", c.wantBands, c.wantReason, ratings, reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,319 @@
+// Package pgndb aggregates PGN games into per-position move statistics that can be queried like the
+// Lichess opening explorer.
+//
+// Games are counted in buckets of speed, rating and month so a query can apply the same filters as an
+// OpeningExplorerRequest without re-reading the games.
+package pgndb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"automock/bitboard"
+	"automock/lichess"
+	"automock/pgnparse"
+)
+
+type Database struct {
+	Games int `json:"games"`
+	// Positions is keyed by bitboard.Board.FENKey, then by UCI move.
+	Positions map[string]map[string]*MoveStats `json:"positions"`
+}
+
+type MoveStats struct {
+	SAN string `json:"san"`
+	// Buckets is keyed by bucketKey.
+	Buckets map[string]*Bucket `json:"buckets"`
+}
+
+// Bucket counts the games with the same speed, rating bucket and month. An empty Speed or Month, or a
+// Rating of -1, means the game didn't say.
+type Bucket struct {
+	Speed  lichess.Speed  `json:"speed"`
+	Rating lichess.Rating `json:"rating"`
+	Month  string         `json:"month"`
+
+	White int `json:"white"`
+	Draws int `json:"draws"`
+	Black int `json:"black"`
+
+	// RatingSum and RatedGames give the average rating of the games
+	RatingSum  int `json:"rating_sum"`
+	RatedGames int `json:"rated_games"`
+}
+
+func New() *Database {
+	return &Database{Positions: make(map[string]map[string]*MoveStats)}
+}
+
+// Open loads a database written by Save, or ingests a .pgn file.
+func Open(fileName string) (*Database, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if strings.EqualFold(filepath.Ext(fileName), ".pgn") {
+		db := New()
+		if err := db.AddPGN(f); err != nil {
+			return nil, xerrors.Errorf("pgn '%s': %w", fileName, err)
+		}
+		return db, nil
+	}
+
+	db, err := Load(f)
+	if err != nil {
+		return nil, xerrors.Errorf("pgn database '%s': %w", fileName, err)
+	}
+	return db, nil
+}
+
+func Load(r io.Reader) (*Database, error) {
+	db := New()
+	if err := json.NewDecoder(r).Decode(db); err != nil {
+		return nil, xerrors.Errorf("%w", err)
+	}
+	return db, nil
+}
+
+func (db *Database) Save(w io.Writer) error {
+	if err := json.NewEncoder(w).Encode(db); err != nil {
+		return xerrors.Errorf("%w", err)
+	}
+	return nil
+}
+
+// AddPGN parses r and adds its games. Games that can't be replayed are skipped.
+func (db *Database) AddPGN(r io.Reader) error {
+	pgn, err := pgnparse.ParseReader(r)
+	if err != nil {
+		return xerrors.Errorf("%w", err)
+	}
+
+	for _, game := range pgn.Games {
+		if err := game.HydrateMoves(); err != nil {
+			continue
+		}
+		db.AddGame(game)
+	}
+
+	return nil
+}
+
+// AddGame adds the mainline of a game whose moves have been hydrated. Unfinished games are skipped.
+func (db *Database) AddGame(game *pgnparse.Game) {
+	if game.Result == pgnparse.ResultUnknown || game.Result == "" {
+		return
+	}
+
+	speed := gameSpeed(game.Tags.Get("TimeControl"))
+	month := gameMonth(game)
+
+	rating, rated := gameRating(game)
+	bucket := lichess.Rating(-1)
+	if rated {
+		bucket = lichess.RatingBucket(rating)
+	}
+
+	key := bucketKey(speed, bucket, month)
+
+	for _, move := range game.Moves {
+		moves, ok := db.Positions[move.FENKey]
+		if !ok {
+			moves = make(map[string]*MoveStats)
+			db.Positions[move.FENKey] = moves
+		}
+
+		stats, ok := moves[move.UCI]
+		if !ok {
+			stats = &MoveStats{SAN: move.SAN, Buckets: make(map[string]*Bucket)}
+			moves[move.UCI] = stats
+		}
+
+		b, ok := stats.Buckets[key]
+		if !ok {
+			b = &Bucket{Speed: speed, Rating: bucket, Month: month}
+			stats.Buckets[key] = b
+		}
+
+		switch game.Result {
+		case pgnparse.ResultWhiteWins:
+			b.White++
+		case pgnparse.ResultBlackWins:
+			b.Black++
+		default:
+			b.Draws++
+		}
+
+		if rated {
+			b.RatingSum += rating
+			b.RatedGames++
+		}
+	}
+
+	db.Games++
+}
+
+// GetGames answers an explorer request from the database. It has the same signature as
+// lichess.GetLichessGames so the two can be swapped.
+//
+// Games without a time control, rating or date only match when the request doesn't filter on it.
+func (db *Database) GetGames(ctx context.Context, req lichess.OpeningExplorerRequest) (lichess.OpeningExplorerResponse, error) {
+	fen := req.FEN
+	if fen == "" {
+		fen = "startpos"
+	}
+
+	b, err := bitboard.ParseFEN(fen)
+	if err != nil {
+		return lichess.OpeningExplorerResponse{}, xerrors.Errorf("%w", err)
+	}
+
+	if req.Play != "" {
+		if b, err = b.Apply(strings.Split(req.Play, ",")...); err != nil {
+			return lichess.OpeningExplorerResponse{}, xerrors.Errorf("%w", err)
+		}
+	}
+
+	filter := newFilter(req)
+
+	var resp lichess.OpeningExplorerResponse
+	for uci, stats := range db.Positions[b.FENKey()] {
+		move := lichess.OpeningExplorerMove{UCI: uci, SAN: stats.SAN}
+
+		var ratingSum, ratedGames int
+		for _, bucket := range stats.Buckets {
+			if !filter.matches(bucket) {
+				continue
+			}
+			move.White += bucket.White
+			move.Draws += bucket.Draws
+			move.Black += bucket.Black
+			ratingSum += bucket.RatingSum
+			ratedGames += bucket.RatedGames
+		}
+
+		if move.Total() == 0 {
+			continue
+		}
+		if ratedGames > 0 {
+			move.AverageRating = ratingSum / ratedGames
+		}
+
+		resp.White += move.White
+		resp.Draws += move.Draws
+		resp.Black += move.Black
+		resp.Moves = append(resp.Moves, move)
+	}
+
+	sort.Slice(resp.Moves, func(i, j int) bool {
+		a, b := resp.Moves[i], resp.Moves[j]
+		if a.Total() != b.Total() {
+			return a.Total() > b.Total()
+		}
+		return a.UCI < b.UCI
+	})
+
+	maxMoves := req.Moves
+	if maxMoves == 0 {
+		maxMoves = 20
+	}
+	if len(resp.Moves) > maxMoves {
+		resp.Moves = resp.Moves[:maxMoves]
+	}
+
+	return resp, nil
+}
+
+type filter struct {
+	speeds  map[lichess.Speed]bool
+	ratings map[lichess.Rating]bool
+	since   string
+	until   string
+
+	// allSpeeds and allRatings let games that didn't record them through
+	allSpeeds  bool
+	allRatings bool
+}
+
+func newFilter(req lichess.OpeningExplorerRequest) filter {
+	f := filter{
+		speeds:     make(map[lichess.Speed]bool),
+		ratings:    make(map[lichess.Rating]bool),
+		since:      req.Since.String(),
+		until:      req.Until.String(),
+		allSpeeds:  len(req.Speeds) == 0 || len(req.Speeds) == len(lichess.ValidSpeeds),
+		allRatings: len(req.Ratings) == 0 || len(req.Ratings) == len(lichess.ValidRatings),
+	}
+
+	for _, speed := range req.Speeds {
+		f.speeds[speed] = true
+	}
+	for _, rating := range req.Ratings {
+		f.ratings[rating] = true
+	}
+
+	return f
+}
+
+func (f filter) matches(b *Bucket) bool {
+	if !f.allSpeeds && !f.speeds[b.Speed] {
+		return false
+	}
+	if !f.allRatings && !f.ratings[b.Rating] {
+		return false
+	}
+	if f.since != "" && (b.Month == "" || b.Month < f.since) {
+		return false
+	}
+	if f.until != "" && (b.Month == "" || b.Month > f.until) {
+		return false
+	}
+	return true
+}
+
+func bucketKey(speed lichess.Speed, rating lichess.Rating, month string) string {
+	return fmt.Sprintf("%s/%d/%s", speed, rating, month)
+}
+
+// gameRating is the average of the players' Elo tags, or the one that's set.
+func gameRating(game *pgnparse.Game) (int, bool) {
+	switch {
+	case game.WhiteElo > 0 && game.BlackElo > 0:
+		return (game.WhiteElo + game.BlackElo) / 2, true
+	case game.WhiteElo > 0:
+		return game.WhiteElo, true
+	case game.BlackElo > 0:
+		return game.BlackElo, true
+	default:
+		return 0, false
+	}
+}
+
+// gameMonth returns the YYYY-MM the game was played in, from the UTCDate or Date tag.
+func gameMonth(game *pgnparse.Game) string {
+	if dt := game.Date(); !dt.IsZero() {
+		return dt.Format("2006-01")
+	}
+
+	// Date is YYYY.MM.DD with unknown parts as ??
+	date := game.Tags.Get("Date")
+	if len(date) < 7 {
+		return ""
+	}
+	dt, err := time.Parse("2006.01", date[:7])
+	if err != nil {
+		return ""
+	}
+	return dt.Format("2006-01")
+}
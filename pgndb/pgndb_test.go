@@ -0,0 +1,195 @@
+package pgndb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"automock/lichess"
+)
+
+const testPGN = `[Event "Club blitz"]
+[Date "2023.04.01"]
+[White "alice"]
+[Black "bob"]
+[Result "1-0"]
+[WhiteElo "1650"]
+[BlackElo "1750"]
+[TimeControl "180+2"]
+
+1. e4 c5 2. Nf3 d6 1-0
+
+[Event "Club blitz"]
+[Date "2023.05.01"]
+[White "bob"]
+[Black "alice"]
+[Result "1/2-1/2"]
+[WhiteElo "1750"]
+[BlackElo "1650"]
+[TimeControl "180+2"]
+
+1. e4 e5 2. Nf3 Nc6 1/2-1/2
+
+[Event "Club classical"]
+[Date "2023.06.??"]
+[White "carol"]
+[Black "alice"]
+[Result "0-1"]
+[WhiteElo "2100"]
+[BlackElo "1900"]
+[TimeControl "5400+30"]
+
+1. d4 d5 2. c4 e6 0-1
+
+[Event "Casual"]
+[Date "????.??.??"]
+[White "dave"]
+[Black "erin"]
+[Result "0-1"]
+
+1. e4 c5 0-1
+
+[Event "Unfinished"]
+[Date "2023.06.01"]
+[White "dave"]
+[Black "erin"]
+[Result "*"]
+
+1. e4 c5 *
+`
+
+func TestDatabase_GetGames(t *testing.T) {
+	cases := []struct {
+		name string
+		req  lichess.OpeningExplorerRequest
+		want string
+	}{
+		{
+			name: "no filters",
+			req:  lichess.OpeningExplorerRequest{FEN: "startpos"},
+			want: "e2e4 e4 1/1/1 1700|d2d4 d4 0/0/1 2000",
+		},
+		{
+			name: "after moves",
+			req:  lichess.OpeningExplorerRequest{FEN: "startpos", Play: "e2e4"},
+			want: "c7c5 c5 1/0/1 1700|e7e5 e5 0/1/0 1700",
+		},
+		{
+			name: "speed",
+			req:  lichess.OpeningExplorerRequest{FEN: "startpos", Speeds: lichess.Speeds{lichess.Blitz}},
+			want: "e2e4 e4 1/1/0 1700",
+		},
+		{
+			name: "rating",
+			req:  lichess.OpeningExplorerRequest{FEN: "startpos", Ratings: lichess.Ratings{lichess.R2000}},
+			want: "d2d4 d4 0/0/1 2000",
+		},
+		{
+			name: "since",
+			req:  lichess.OpeningExplorerRequest{FEN: "startpos", Since: lichess.Date{Year: 2023, Month: 5}},
+			want: "d2d4 d4 0/0/1 2000|e2e4 e4 0/1/0 1700",
+		},
+		{
+			name: "until",
+			req:  lichess.OpeningExplorerRequest{FEN: "startpos", Until: lichess.Date{Year: 2023, Month: 4}},
+			want: "e2e4 e4 1/0/0 1700",
+		},
+		{
+			name: "unknown position",
+			req:  lichess.OpeningExplorerRequest{FEN: "startpos", Play: "a2a3"},
+			want: "",
+		},
+	}
+
+	db := New()
+	if err := db.AddPGN(strings.NewReader(testPGN)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// act
+			resp, err := db.GetGames(context.Background(), c.req)
+
+			// assert
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := formatMoves(resp); c.want != got {
+				t.Errorf("want: %q got: %q", c.want, got)
+			}
+		})
+	}
+}
+
+func TestDatabase_SaveLoad(t *testing.T) {
+	// arrange
+	db := New()
+	if err := db.AddPGN(strings.NewReader(testPGN)); err != nil {
+		t.Fatal(err)
+	}
+
+	// act
+	var buf bytes.Buffer
+	if err := db.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// assert
+	if want, got := 4, loaded.Games; want != got {
+		t.Errorf("games want: %d got: %d", want, got)
+	}
+
+	req := lichess.OpeningExplorerRequest{FEN: "startpos", Speeds: lichess.Speeds{lichess.Blitz}}
+	want, _ := db.GetGames(context.Background(), req)
+	got, _ := loaded.GetGames(context.Background(), req)
+	if formatMoves(want) != formatMoves(got) {
+		t.Errorf("want: %q got: %q", formatMoves(want), formatMoves(got))
+	}
+}
+
+func TestGameSpeed(t *testing.T) {
+	cases := []struct {
+		timeControl string
+		want        lichess.Speed
+	}{
+		{timeControl: "", want: ""},
+		{timeControl: "-", want: lichess.Correspondence},
+		{timeControl: "15+0", want: lichess.UltraBullet},
+		{timeControl: "60+0", want: lichess.Bullet},
+		{timeControl: "120+1", want: lichess.Bullet},
+		{timeControl: "180+2", want: lichess.Blitz},
+		{timeControl: "600+0", want: lichess.Rapid},
+		{timeControl: "900+10", want: lichess.Rapid},
+		{timeControl: "1800+0", want: lichess.Classical},
+		{timeControl: "40/5400:1800+30", want: lichess.Classical},
+		{timeControl: "1/259200", want: lichess.Correspondence},
+		{timeControl: "blitz", want: ""},
+	}
+
+	for _, c := range cases {
+		t.Run(c.timeControl, func(t *testing.T) {
+			// act
+			got := gameSpeed(c.timeControl)
+
+			// assert
+			if c.want != got {
+				t.Errorf("want: %q got: %q", c.want, got)
+			}
+		})
+	}
+}
+
+func formatMoves(resp lichess.OpeningExplorerResponse) string {
+	moves := make([]string, len(resp.Moves))
+	for i, move := range resp.Moves {
+		moves[i] = fmt.Sprintf("%s %s %d/%d/%d %d", move.UCI, move.SAN, move.White, move.Draws, move.Black, move.AverageRating)
+	}
+	return strings.Join(moves, "|")
+}
@@ -0,0 +1,67 @@
+package pgndb
+
+import (
+	"strconv"
+	"strings"
+
+	"automock/lichess"
+)
+
+// gameSpeed maps a PGN TimeControl tag to a Lichess speed using the Lichess formula: the initial time
+// plus 40 times the increment. It returns "" if the tag is missing or can't be parsed.
+//
+// The tag is "-" for no time control, "base+increment" in seconds, "moves/seconds" for a period, and
+// several periods separated by ":". Only the first period is used.
+func gameSpeed(timeControl string) lichess.Speed {
+	switch timeControl {
+	case "", "?":
+		return ""
+	case "-":
+		return lichess.Correspondence
+	}
+
+	period := strings.SplitN(timeControl, ":", 2)[0]
+
+	// moves/seconds. a day or more per move is correspondence, otherwise the period is the base time.
+	if idx := strings.Index(period, "/"); idx != -1 {
+		moves, err := strconv.Atoi(period[:idx])
+		if err != nil {
+			return ""
+		}
+		seconds, err := strconv.Atoi(period[idx+1:])
+		if err != nil {
+			return ""
+		}
+		if moves > 0 && seconds/moves >= 24*60*60 {
+			return lichess.Correspondence
+		}
+		period = period[idx+1:]
+	}
+
+	var base, increment int
+	parts := strings.SplitN(period, "+", 2)
+
+	base, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return ""
+	}
+	if len(parts) == 2 {
+		if increment, err = strconv.Atoi(parts[1]); err != nil {
+			return ""
+		}
+	}
+
+	estimated := base + 40*increment
+	switch {
+	case estimated < 30:
+		return lichess.UltraBullet
+	case estimated < 180:
+		return lichess.Bullet
+	case estimated < 480:
+		return lichess.Blitz
+	case estimated < 1500:
+		return lichess.Rapid
+	default:
+		return lichess.Classical
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/xerrors"
+
+	"automock/config"
+	"automock/pgndb"
+	"automock/utils"
+)
+
+type pgnIngestCmd struct {
+	Files  []string `arg:"" help:"PGN files to ingest." type:"existingfile"`
+	Output string   `short:"o" required:"" help:"Database file to write." type:"path"`
+}
+
+func (c pgnIngestCmd) Run(cfg config.Config) error {
+	db := pgndb.New()
+
+	for _, fileName := range c.Files {
+		games := db.Games
+
+		f, err := os.Open(fileName)
+		if err != nil {
+			return err
+		}
+		err = db.AddPGN(f)
+		f.Close()
+		if err != nil {
+			return xerrors.Errorf("pgn '%s': %w", fileName, err)
+		}
+
+		fmt.Fprintf(os.Stderr, "%s: %d games\n", fileName, db.Games-games)
+	}
+
+	f, err := os.Create(c.Output)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := db.Save(f); err != nil {
+		return xerrors.Errorf("%w", err)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	msg := fmt.Sprintf("pgn ingest: wrote %d games, %d positions to '%s'", db.Games, len(db.Positions), c.Output)
+	utils.Log(msg)
+	fmt.Fprintln(os.Stderr, msg)
+
+	return nil
+}
@@ -74,13 +74,8 @@ func (pgn *PGN) HydrateMoves() error {
 		go func(game *Game) {
 			defer wg.Done()
 
-			var startPos = bitboard.StartPosKey
-			if pos := game.Tags.Get("FEN"); pos != "" {
-				startPos = pos
-			}
-
-			if err := fillMovesUCIs(game.Moves, startPos, 0); err != nil {
-				panic(fmt.Errorf("startpos: '%s' %v\ngame:\n%s", startPos, err, game.String()))
+			if err := game.HydrateMoves(); err != nil {
+				panic(err)
 			}
 		}(pgn.Games[i])
 	}
@@ -90,6 +85,20 @@ func (pgn *PGN) HydrateMoves() error {
 	return nil
 }
 
+// HydrateMoves fills in the UCI and FENKey of each move, starting from the FEN tag if the game has one.
+func (g *Game) HydrateMoves() error {
+	var startPos = bitboard.StartPosKey
+	if pos := g.Tags.Get("FEN"); pos != "" {
+		startPos = pos
+	}
+
+	if err := fillMovesUCIs(g.Moves, startPos, 0); err != nil {
+		return fmt.Errorf("startpos: '%s' %v\ngame:\n%s", startPos, err, g.String())
+	}
+
+	return nil
+}
+
 func Parse(input string) (*PGN, error) {
 	pgn, err := parse([]byte(input))
 	if err != nil {
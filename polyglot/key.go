@@ -0,0 +1,62 @@
+package polyglot
+
+import (
+	"automock/bitboard"
+)
+
+const (
+	castleOffset    = 768
+	enPassantOffset = 772
+	turnOffset      = 780
+)
+
+// Key returns the Polyglot Zobrist hash of a position.
+func Key(b bitboard.Board) uint64 {
+	var key uint64
+
+	// pieces. polyglot orders kinds black pawn, white pawn, black knight, ... white king.
+	for color := bitboard.White; color <= bitboard.Black; color++ {
+		for pieceType := bitboard.Pawn; pieceType <= bitboard.King; pieceType++ {
+			kind := 2 * pieceType
+			if color == bitboard.White {
+				kind++
+			}
+
+			pieces := b.Pieces[color][pieceType]
+			for pieces != 0 {
+				sq := pieces.NextBit()
+				pieces &= pieces - 1
+
+				row, file := rowFile(sq)
+				key ^= random64[64*kind+8*row+file]
+			}
+		}
+	}
+
+	// castling, b.Castle bits are K=1 Q=2 k=4 q=8, the same order polyglot uses
+	for i := 0; i < 4; i++ {
+		if b.Castle&(1<<i) != 0 {
+			key ^= random64[castleOffset+i]
+		}
+	}
+
+	// en passant only counts if the side to move has a pawn that can make the capture
+	if b.EPTargetSquare != 0 {
+		s := b.ActiveColor
+		if b.Pieces[s][bitboard.Pawn]&bitboard.PawnDefends[s][b.EPTargetSquare] != 0 {
+			_, file := rowFile(b.EPTargetSquare)
+			key ^= random64[enPassantOffset+file]
+		}
+	}
+
+	if b.ActiveColor == bitboard.White {
+		key ^= random64[turnOffset]
+	}
+
+	return key
+}
+
+// rowFile converts a bitboard square index (h1=0, a1=7) to polyglot's row and file (a1 = row 0, file 0).
+func rowFile(sq int) (int, int) {
+	return sq / 8, 7 - sq%8
+}
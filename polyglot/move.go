@@ -0,0 +1,85 @@
+package polyglot
+
+import (
+	"strings"
+
+	"golang.org/x/xerrors"
+
+	"automock/bitboard"
+)
+
+var promotionPieces = [5]string{"", "n", "b", "r", "q"}
+
+// DecodeMove converts a book move to UCI. The board is needed to tell castling from a rook move.
+func DecodeMove(b bitboard.Board, move uint16) string {
+	toFile := int(move & 0b111)
+	toRow := int((move >> 3) & 0b111)
+	fromFile := int((move >> 6) & 0b111)
+	fromRow := int((move >> 9) & 0b111)
+	promo := int((move >> 12) & 0b111)
+
+	uci := squareName(fromRow, fromFile) + squareName(toRow, toFile)
+
+	// castling is encoded as the king capturing its own rook
+	if castle, ok := bitboard.KingTakesRook[uci]; ok {
+		from := squareBits(fromRow, fromFile)
+		if b.Pieces[b.ActiveColor][bitboard.King]&from == from {
+			uci = castle
+		}
+	}
+
+	if promo > 0 && promo < len(promotionPieces) {
+		uci += promotionPieces[promo]
+	}
+
+	return uci
+}
+
+// EncodeMove converts a UCI move to the book encoding. It's the inverse of DecodeMove.
+func EncodeMove(b bitboard.Board, uci string) (uint16, error) {
+	if len(uci) != 4 && len(uci) != 5 {
+		return 0, xerrors.Errorf("invalid move '%s'", uci)
+	}
+
+	for i := 0; i < 4; i += 2 {
+		if uci[i] < 'a' || uci[i] > 'h' || uci[i+1] < '1' || uci[i+1] > '8' {
+			return 0, xerrors.Errorf("invalid move '%s'", uci)
+		}
+	}
+
+	fromFile, fromRow := int(uci[0]-'a'), int(uci[1]-'1')
+	toFile, toRow := int(uci[2]-'a'), int(uci[3]-'1')
+
+	for rookMove, castle := range bitboard.KingTakesRook {
+		if castle != uci[:4] {
+			continue
+		}
+		from := squareBits(fromRow, fromFile)
+		if b.Pieces[b.ActiveColor][bitboard.King]&from == from {
+			toFile = int(rookMove[2] - 'a')
+		}
+	}
+
+	var promo int
+	if len(uci) == 5 {
+		for i := 1; i < len(promotionPieces); i++ {
+			if promotionPieces[i] == strings.ToLower(uci[4:]) {
+				promo = i
+			}
+		}
+		if promo == 0 {
+			return 0, xerrors.Errorf("invalid promotion in move '%s'", uci)
+		}
+	}
+
+	return uint16(promo<<12 | fromRow<<9 | fromFile<<6 | toRow<<3 | toFile), nil
+}
+
+// squareBits returns the bitboard mask for a polyglot row and file.
+func squareBits(row, file int) bitboard.Bits {
+	return bitboard.Bits(1) << (row*8 + 7 - file)
+}
+
+func squareName(row, file int) string {
+	return string([]byte{byte('a' + file), byte('1' + row)})
+}
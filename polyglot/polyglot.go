@@ -0,0 +1,126 @@
+// Package polyglot reads opening books in the Polyglot .bin format.
+//
+// A book is a sequence of 16 byte big-endian entries sorted by key:
+//
+//	key    uint64  Zobrist hash of the position, see Key
+//	move   uint16  to file/rank, from file/rank and promotion, 3 bits each
+//	weight uint16  relative frequency of the move
+//	learn  uint32  unused
+package polyglot
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"sort"
+
+	"golang.org/x/xerrors"
+
+	"automock/bitboard"
+)
+
+const entrySize = 16
+
+type Entry struct {
+	Key    uint64
+	Move   uint16
+	Weight uint16
+	Learn  uint32
+}
+
+// Move is a book move for a position.
+type Move struct {
+	UCI    string
+	Weight int
+}
+
+type Book struct {
+	entries []Entry
+}
+
+// Open reads the book at fileName into memory.
+func Open(fileName string) (*Book, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	book, err := Read(f)
+	if err != nil {
+		return nil, xerrors.Errorf("book '%s': %w", fileName, err)
+	}
+
+	return book, nil
+}
+
+// Read reads a book from r. Entries don't need to be sorted.
+func Read(r io.Reader) (*Book, error) {
+	br := bufio.NewReader(r)
+
+	var (
+		entries []Entry
+		buf     [entrySize]byte
+	)
+
+	for {
+		if _, err := io.ReadFull(br, buf[:]); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				return nil, xerrors.Errorf("truncated entry at offset %d", len(entries)*entrySize)
+			}
+			return nil, xerrors.Errorf("%w", err)
+		}
+
+		entries = append(entries, Entry{
+			Key:    binary.BigEndian.Uint64(buf[0:8]),
+			Move:   binary.BigEndian.Uint16(buf[8:10]),
+			Weight: binary.BigEndian.Uint16(buf[10:12]),
+			Learn:  binary.BigEndian.Uint32(buf[12:16]),
+		})
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Key < entries[j].Key
+	})
+
+	return &Book{entries: entries}, nil
+}
+
+// Len returns the number of entries in the book.
+func (b *Book) Len() int {
+	return len(b.entries)
+}
+
+// Lookup returns the book moves for a position. Entries whose move isn't legal in the position, which
+// can happen on a hash collision, are skipped.
+func (b *Book) Lookup(board bitboard.Board) []Move {
+	key := Key(board)
+
+	i := sort.Search(len(b.entries), func(i int) bool {
+		return b.entries[i].Key >= key
+	})
+
+	legalMoves := make(map[string]struct{})
+	for _, uci := range board.LegalMoves() {
+		legalMoves[uci] = struct{}{}
+	}
+
+	var moves []Move
+	for ; i < len(b.entries) && b.entries[i].Key == key; i++ {
+		entry := b.entries[i]
+
+		uci := DecodeMove(board, entry.Move)
+		if _, ok := legalMoves[uci]; !ok {
+			continue
+		}
+
+		moves = append(moves, Move{UCI: uci, Weight: int(entry.Weight)})
+	}
+
+	return moves
+}
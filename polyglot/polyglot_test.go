@@ -0,0 +1,136 @@
+package polyglot
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"testing"
+
+	"automock/bitboard"
+)
+
+func TestKey(t *testing.T) {
+	// test vectors from the polyglot book format specification
+	cases := []struct {
+		moves string
+		want  uint64
+	}{
+		{moves: "", want: 0x463b96181691fc9c},
+		{moves: "e2e4", want: 0x823c9b50fd114196},
+		{moves: "e2e4 d7d5", want: 0x0756b94461c50fb0},
+		{moves: "e2e4 d7d5 e4e5", want: 0x662fafb965db29d4},
+		{moves: "e2e4 d7d5 e4e5 f7f5", want: 0x22a48b5a8e47ff78},
+		{moves: "e2e4 d7d5 e4e5 f7f5 e1e2", want: 0x652a607ca3f242c1},
+		{moves: "e2e4 d7d5 e4e5 f7f5 e1e2 e8f7", want: 0x00fdd303c946bdd9},
+		{moves: "a2a4 b7b5 h2h4 b5b4 c2c4", want: 0x3c8123ea7b067637},
+		{moves: "a2a4 b7b5 h2h4 b5b4 c2c4 b4c3 a1a3", want: 0x5c3f9b829b279560},
+	}
+
+	for _, c := range cases {
+		t.Run(c.moves, func(t *testing.T) {
+			// arrange
+			b := bitboard.StartPosBoard()
+			if c.moves != "" {
+				var err error
+				b, err = b.Apply(strings.Split(c.moves, " ")...)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// act
+			got := Key(b)
+
+			// assert
+			if c.want != got {
+				t.Errorf("want: %016x got: %016x", c.want, got)
+			}
+		})
+	}
+}
+
+func TestDecodeMove(t *testing.T) {
+	cases := []struct {
+		fen  string
+		move uint16
+		want string
+	}{
+		{fen: bitboard.StartPos, move: encode(1, 4, 3, 4, 0), want: "e2e4"},
+		{fen: bitboard.StartPos, move: encode(0, 6, 2, 5, 0), want: "g1f3"},
+		{fen: "r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", move: encode(0, 4, 0, 7, 0), want: "e1g1"},
+		{fen: "r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", move: encode(0, 4, 0, 0, 0), want: "e1c1"},
+		{fen: "r3k2r/8/8/8/8/8/8/R3K2R b KQkq - 0 1", move: encode(7, 4, 7, 7, 0), want: "e8g8"},
+		{fen: "r3k2r/8/8/8/8/8/8/R3K2R b KQkq - 0 1", move: encode(7, 4, 7, 0, 0), want: "e8c8"},
+		{fen: "4k3/8/8/8/8/8/8/4RK2 w - - 0 1", move: encode(0, 4, 0, 7, 0), want: "e1h1"},
+		{fen: "4k3/P7/8/8/8/8/8/4K3 w - - 0 1", move: encode(6, 0, 7, 0, 4), want: "a7a8q"},
+		{fen: "4k3/P7/8/8/8/8/8/4K3 w - - 0 1", move: encode(6, 0, 7, 0, 1), want: "a7a8n"},
+	}
+
+	for _, c := range cases {
+		t.Run(fmt.Sprintf("%s %s", c.fen, c.want), func(t *testing.T) {
+			// arrange
+			b, err := bitboard.ParseFEN(c.fen)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// act
+			got := DecodeMove(b, c.move)
+
+			// assert
+			if c.want != got {
+				t.Errorf("want: %s got: %s", c.want, got)
+			}
+		})
+	}
+}
+
+func TestBook_Lookup(t *testing.T) {
+	// arrange
+	startKey := Key(bitboard.StartPosBoard())
+
+	entries := []Entry{
+		{Key: startKey + 1, Move: encode(6, 4, 4, 4, 0), Weight: 99},
+		{Key: startKey, Move: encode(1, 3, 3, 3, 0), Weight: 20},
+		{Key: startKey, Move: encode(1, 4, 3, 4, 0), Weight: 30},
+		// illegal in the start position, e.g. from a hash collision
+		{Key: startKey, Move: encode(1, 4, 4, 4, 0), Weight: 50},
+		{Key: startKey - 1, Move: encode(6, 4, 4, 4, 0), Weight: 99},
+	}
+
+	var buf bytes.Buffer
+	for _, entry := range entries {
+		if err := binary.Write(&buf, binary.BigEndian, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	book, err := Read(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// act
+	got := book.Lookup(bitboard.StartPosBoard())
+
+	// assert
+	want := []Move{{UCI: "d2d4", Weight: 20}, {UCI: "e2e4", Weight: 30}}
+	if fmt.Sprint(want) != fmt.Sprint(got) {
+		t.Errorf("want: %v got: %v", want, got)
+	}
+}
+
+func TestRead_Truncated(t *testing.T) {
+	// act
+	_, err := Read(bytes.NewReader(make([]byte, entrySize+3)))
+
+	// assert
+	if err == nil {
+		t.Errorf("want error, got nil")
+	}
+}
+
+func encode(fromRow, fromFile, toRow, toFile, promo int) uint16 {
+	return uint16(promo<<12 | fromRow<<9 | fromFile<<6 | toRow<<3 | toFile)
+}
@@ -0,0 +1,114 @@
+package polyglot
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"math"
+	"sort"
+
+	"golang.org/x/xerrors"
+
+	"automock/bitboard"
+)
+
+// Writer collects book entries and writes them out in the order Read and other Polyglot tools expect.
+type Writer struct {
+	entries []Entry
+	keys    map[uint64]struct{}
+}
+
+func NewWriter() *Writer {
+	return &Writer{keys: make(map[uint64]struct{})}
+}
+
+// Add adds the moves for a position. Weights are scaled down proportionally if the largest doesn't fit
+// in a uint16, moves with a weight of 0 after scaling are dropped. Adding a position that's already in the book
+// is a no-op.
+func (w *Writer) Add(b bitboard.Board, moves []Move) error {
+	key := Key(b)
+	if _, ok := w.keys[key]; ok {
+		return nil
+	}
+
+	var maxWeight int
+	for _, move := range moves {
+		if move.Weight > maxWeight {
+			maxWeight = move.Weight
+		}
+	}
+
+	scale := 1.0
+	if maxWeight > math.MaxUint16 {
+		scale = float64(math.MaxUint16) / float64(maxWeight)
+	}
+
+	entries := make([]Entry, 0, len(moves))
+	for _, move := range moves {
+		encoded, err := EncodeMove(b, move.UCI)
+		if err != nil {
+			return xerrors.Errorf("%w", err)
+		}
+
+		weight := uint16(float64(move.Weight) * scale)
+		if weight == 0 {
+			continue
+		}
+
+		entries = append(entries, Entry{Key: key, Move: encoded, Weight: weight})
+	}
+
+	if len(entries) == 0 {
+		return nil
+	}
+
+	w.keys[key] = struct{}{}
+	w.entries = append(w.entries, entries...)
+
+	return nil
+}
+
+// Len returns the number of entries added.
+func (w *Writer) Len() int {
+	return len(w.entries)
+}
+
+// Positions returns the number of positions added.
+func (w *Writer) Positions() int {
+	return len(w.keys)
+}
+
+// WriteTo writes the entries sorted by key, and by descending weight within a key.
+func (w *Writer) WriteTo(out io.Writer) (int64, error) {
+	sort.SliceStable(w.entries, func(i, j int) bool {
+		if w.entries[i].Key != w.entries[j].Key {
+			return w.entries[i].Key < w.entries[j].Key
+		}
+		return w.entries[i].Weight > w.entries[j].Weight
+	})
+
+	bw := bufio.NewWriter(out)
+
+	var (
+		n   int64
+		buf [entrySize]byte
+	)
+
+	for _, entry := range w.entries {
+		binary.BigEndian.PutUint64(buf[0:8], entry.Key)
+		binary.BigEndian.PutUint16(buf[8:10], entry.Move)
+		binary.BigEndian.PutUint16(buf[10:12], entry.Weight)
+		binary.BigEndian.PutUint32(buf[12:16], entry.Learn)
+
+		if _, err := bw.Write(buf[:]); err != nil {
+			return n, xerrors.Errorf("%w", err)
+		}
+		n += entrySize
+	}
+
+	if err := bw.Flush(); err != nil {
+		return n, xerrors.Errorf("%w", err)
+	}
+
+	return n, nil
+}
@@ -0,0 +1,94 @@
+package polyglot
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"automock/bitboard"
+)
+
+func TestEncodeMove(t *testing.T) {
+	cases := []struct {
+		fen  string
+		uci  string
+		want uint16
+	}{
+		{fen: bitboard.StartPos, uci: "e2e4", want: encode(1, 4, 3, 4, 0)},
+		{fen: "r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", uci: "e1g1", want: encode(0, 4, 0, 7, 0)},
+		{fen: "r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", uci: "e1c1", want: encode(0, 4, 0, 0, 0)},
+		{fen: "r3k2r/8/8/8/8/8/8/R3K2R b KQkq - 0 1", uci: "e8g8", want: encode(7, 4, 7, 7, 0)},
+		{fen: "4k3/8/8/8/8/8/8/4RK2 w - - 0 1", uci: "e1g1", want: encode(0, 4, 0, 6, 0)},
+		{fen: "4k3/P7/8/8/8/8/8/4K3 w - - 0 1", uci: "a7a8q", want: encode(6, 0, 7, 0, 4)},
+	}
+
+	for _, c := range cases {
+		t.Run(fmt.Sprintf("%s %s", c.fen, c.uci), func(t *testing.T) {
+			// arrange
+			b, err := bitboard.ParseFEN(c.fen)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// act
+			got, err := EncodeMove(b, c.uci)
+
+			// assert
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.want != got {
+				t.Errorf("want: %04x got: %04x", c.want, got)
+			}
+			if roundTrip := DecodeMove(b, got); c.uci != roundTrip {
+				t.Errorf("round trip want: %s got: %s", c.uci, roundTrip)
+			}
+		})
+	}
+}
+
+func TestWriter(t *testing.T) {
+	// arrange
+	startPos := bitboard.StartPosBoard()
+	afterE4, err := startPos.Apply("e2e4")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := NewWriter()
+	if err := w.Add(startPos, []Move{{UCI: "d2d4", Weight: 100_000}, {UCI: "e2e4", Weight: 200_000}, {UCI: "a2a3", Weight: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Add(afterE4, []Move{{UCI: "c7c5", Weight: 5}}); err != nil {
+		t.Fatal(err)
+	}
+	// duplicate positions are ignored
+	if err := w.Add(startPos, []Move{{UCI: "g1f3", Weight: 1}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// act
+	var buf bytes.Buffer
+	if _, err := w.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	book, err := Read(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// assert
+	if want, got := 3, book.Len(); want != got {
+		t.Errorf("len want: %d got: %d", want, got)
+	}
+
+	want := []Move{{UCI: "e2e4", Weight: 65535}, {UCI: "d2d4", Weight: 32767}}
+	if got := book.Lookup(startPos); fmt.Sprint(want) != fmt.Sprint(got) {
+		t.Errorf("want: %v got: %v", want, got)
+	}
+
+	want = []Move{{UCI: "c7c5", Weight: 5}}
+	if got := book.Lookup(afterE4); fmt.Sprint(want) != fmt.Sprint(got) {
+		t.Errorf("want: %v got: %v", want, got)
+	}
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"automock/bitboard"
+	"automock/chessdb"
+	"automock/lichess"
+)
+
+const (
+	defaultPrefetchDepth    = 8
+	defaultPrefetchMinGames = 500
+
+	prefetchProgressInterval = time.Second
+)
+
+type prefetchArgs struct {
+	Depth    int
+	MinGames int
+	// Stop ends a running prefetch instead of starting one
+	Stop bool
+}
+
+// parsePrefetch parses "prefetch [depth <plies>] [mingames <games>]" and "prefetch stop".
+func parsePrefetch(line string) (prefetchArgs, error) {
+	args := prefetchArgs{Depth: defaultPrefetchDepth, MinGames: defaultPrefetchMinGames}
+
+	parts := strings.Fields(line)
+	if len(parts) > 1 && strings.EqualFold(parts[1], "stop") {
+		if len(parts) > 2 {
+			return prefetchArgs{}, xerrors.Errorf("prefetch stop takes no arguments: '%s'", line)
+		}
+		return prefetchArgs{Stop: true}, nil
+	}
+
+	for i := 1; i < len(parts); i += 2 {
+		cmd := strings.ToLower(parts[i])
+		if i+1 >= len(parts) {
+			return prefetchArgs{}, xerrors.Errorf("prefetch string has missing argument after '%s': '%s'", cmd, line)
+		}
+		n, err := strconv.Atoi(parts[i+1])
+		if err != nil || n < 0 {
+			return prefetchArgs{}, xerrors.Errorf("prefetch string has invalid int argument after '%s': '%s'", cmd, line)
+		}
+
+		switch cmd {
+		case "depth":
+			if n < 1 {
+				return prefetchArgs{}, xerrors.Errorf("prefetch depth must be at least 1: '%s'", line)
+			}
+			args.Depth = n
+		case "mingames":
+			args.MinGames = n
+		default:
+			return prefetchArgs{}, xerrors.Errorf("prefetch string has unrecognized command '%s' at position %d: '%s'", cmd, i, line)
+		}
+	}
+
+	return args, nil
+}
+
+// handlePrefetch walks the explorer tree from the current position in the background and fills the
+// cache with the explorer, Lichess_Player, cloud eval and chessdb responses a 'go' would look up, under
+// the current Lichess_* and UCI_LimitStrength settings. Requests go through the rate limiter like any
+// other. 'prefetch stop' ends it; 'stop' is left to the search, since GUIs send it all the time. Cached
+// responses are answered from the cache, so running prefetch again carries on where it left off.
+func (e *Engine) handlePrefetch(line string) {
+	args, err := parsePrefetch(line)
+	if err != nil {
+		uciWriteLine(fmt.Sprintf("info string %s", err.Error()))
+		return
+	}
+
+	if args.Stop {
+		if !e.stopPrefetch() {
+			uciWriteLine("info string no prefetch running, ignoring 'prefetch stop'")
+		}
+		return
+	}
+
+	if e.Offline {
+		uciWriteLine("info string prefetch needs the network, but Offline is set")
+		return
+	}
+
+	startFEN, moves := e.readPosition()
+
+	bb, err := bitboard.ParseFEN(startFEN)
+	if err == nil {
+		bb, err = bb.Apply(moves...)
+	}
+	if err != nil {
+		uciWriteLine(fmt.Sprintf("info string %s", err.Error()))
+		return
+	}
+
+	e.prefetchMtx.Lock()
+	if e.cancelPrefetch != nil {
+		e.prefetchMtx.Unlock()
+		uciWriteLine("info string prefetch already running, ignoring 'prefetch'")
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	e.cancelPrefetch = cancel
+	e.prefetchMtx.Unlock()
+
+	p := e.newPrefetcher(args, startFEN, moves)
+	uciWriteLine(fmt.Sprintf("info string prefetch started depth %d mingames %d", args.Depth, args.MinGames))
+
+	go func() {
+		defer func() {
+			e.prefetchMtx.Lock()
+			e.cancelPrefetch = nil
+			e.prefetchMtx.Unlock()
+			cancel()
+		}()
+
+		start := time.Now()
+
+		result, err := p.Prefetch(ctx, bb.FEN())
+		if err != nil {
+			uciWriteLine(fmt.Sprintf("info string prefetch stopped after %d positions: %s", result.Positions, err.Error()))
+			return
+		}
+
+		uciWriteLine(fmt.Sprintf("info string prefetch done positions %d player %d cloudevals %d chessdb %d time %d",
+			result.Positions, result.Players, result.CloudEvals, result.QueryAlls, time.Since(start).Milliseconds()))
+	}()
+}
+
+// stopPrefetch cancels the running prefetch and reports whether there was one.
+func (e *Engine) stopPrefetch() bool {
+	e.prefetchMtx.Lock()
+	defer e.prefetchMtx.Unlock()
+
+	if e.cancelPrefetch == nil {
+		return false
+	}
+	e.cancelPrefetch()
+	e.cancelPrefetch = nil
+	return true
+}
+
+// newPrefetcher fetches the same requests 'go' makes from each position. The engine settings are read
+// now so a setoption during the prefetch doesn't change them halfway.
+func (e *Engine) newPrefetcher(args prefetchArgs, startFEN string, gameMoves []string) prefetcher {
+	database := e.LichessDatabase
+	pgnDB := e.pgnDB
+	mastersSince := e.LichessMastersSince
+	mastersUntil := e.LichessMastersUntil
+
+	// the explorer is asked for the game's moves followed by the moves walked, as in 'go'
+	baseReq := e.lichessRequest(startFEN, gameMoves)
+	request := func(_ string, moves []string) lichess.OpeningExplorerRequest {
+		req := baseReq
+		req.Play = strings.Join(append(append([]string(nil), gameMoves...), moves...), ",")
+		return req
+	}
+
+	// 'go' asks for one of the buckets either side of UCI_Elo at a time, so each is fetched on its own.
+	// Only the lichess games are split by rating; the masters games are the same whatever the bucket.
+	var ratings []lichess.Ratings
+	if e.UCILimitStrength && (database == DatabaseLichess || database == DatabaseBlend) {
+		for _, rating := range limitStrengthRatings(e.UCIElo) {
+			ratings = append(ratings, lichess.Ratings{rating})
+		}
+	}
+
+	var player func(ctx context.Context, b bitboard.Board, moves []string) error
+	if e.LichessPlayer != "" && e.LichessPlayerWeight > 0 {
+		playerReq := lichess.PlayerExplorerRequest{
+			Player: e.LichessPlayer,
+			FEN:    startFEN,
+			Speeds: e.LichessSpeeds,
+			Since:  e.LichessSince,
+			Until:  e.LichessUntil,
+		}
+		player = func(ctx context.Context, b bitboard.Board, moves []string) error {
+			req := playerReq
+			req.Color = lichess.White
+			if b.ActiveColor == bitboard.Black {
+				req.Color = lichess.Black
+			}
+			req.Play = strings.Join(append(append([]string(nil), gameMoves...), moves...), ",")
+			_, err := lichess.GetPlayerGames(ctx, req)
+			return err
+		}
+	}
+
+	var lastProgress time.Time
+
+	return prefetcher{
+		walker: bookExporter{
+			request:  request,
+			Depth:    args.Depth,
+			MinGames: args.MinGames,
+			Progress: func(fetched, queued int) {
+				if time.Since(lastProgress) < prefetchProgressInterval {
+					return
+				}
+				lastProgress = time.Now()
+				uciWriteLine(fmt.Sprintf("info string prefetch positions %d queued %d", fetched, queued))
+			},
+		},
+		ratings: ratings,
+		fetch: func(ctx context.Context, req lichess.OpeningExplorerRequest) (lichess.OpeningExplorerResponse, string, error) {
+			mastersReq := lichess.MastersExplorerRequest{FEN: req.FEN, Play: req.Play, Since: mastersSince, Until: mastersUntil}
+			return getDatabaseGames(ctx, database, pgnDB, req, mastersReq, &skippedSources{})
+		},
+		player: player,
+		cloudEval: func(ctx context.Context, fen string) error {
+			_, err := lichess.GetCloudEval(ctx, fen, cloudEvalMultiPV)
+			return err
+		},
+		queryAll: func(ctx context.Context, fen string) error {
+			_, err := chessdb.QueryAll(ctx, fen)
+			return err
+		},
+	}
+}
+
+// prefetcher walks the explorer tree and looks up the evaluations of every position in it.
+type prefetcher struct {
+	walker bookExporter
+	// ratings, if set, are fetched one request each and the responses merged for the walk
+	ratings []lichess.Ratings
+	// fetch, player, cloudEval and queryAll look up a position, replaced in tests. fetch also returns the
+	// source of the response, as getDatabaseGames does. player is nil without a Lichess_Player.
+	fetch     func(ctx context.Context, req lichess.OpeningExplorerRequest) (lichess.OpeningExplorerResponse, string, error)
+	player    func(ctx context.Context, b bitboard.Board, moves []string) error
+	cloudEval func(ctx context.Context, fen string) error
+	queryAll  func(ctx context.Context, fen string) error
+}
+
+type prefetchResult struct {
+	Positions  int
+	Players    int
+	CloudEvals int
+	QueryAlls  int
+}
+
+// fetchRatings fetches req for each of ratings and adds up the games of each move. A blend position
+// answered from the masters games has the same response for every bucket, so that's returned as it is.
+func (p prefetcher) fetchRatings(ctx context.Context, req lichess.OpeningExplorerRequest) (lichess.OpeningExplorerResponse, error) {
+	if len(p.ratings) == 0 {
+		resp, _, err := p.fetch(ctx, req)
+		return resp, err
+	}
+
+	var (
+		merged  lichess.OpeningExplorerResponse
+		index   = make(map[string]int)
+		masters *lichess.OpeningExplorerResponse
+	)
+	for _, ratings := range p.ratings {
+		ratingsReq := req
+		ratingsReq.Ratings = ratings
+
+		resp, source, err := p.fetch(ctx, ratingsReq)
+		if err != nil {
+			return lichess.OpeningExplorerResponse{}, xerrors.Errorf("ratings %s: %w", ratings, err)
+		}
+		if source != "lichess_data" {
+			masters = &resp
+			continue
+		}
+
+		merged.White += resp.White
+		merged.Draws += resp.Draws
+		merged.Black += resp.Black
+		for _, move := range resp.Moves {
+			i, ok := index[move.UCI]
+			if !ok {
+				index[move.UCI] = len(merged.Moves)
+				merged.Moves = append(merged.Moves, move)
+				continue
+			}
+			merged.Moves[i].White += move.White
+			merged.Moves[i].Draws += move.Draws
+			merged.Moves[i].Black += move.Black
+		}
+	}
+
+	if masters != nil {
+		return *masters, nil
+	}
+	return merged, nil
+}
+
+// Prefetch walks the tree from rootFEN. A position missing from the cloud eval or chessdb isn't an
+// error; an explorer error ends the walk.
+func (p prefetcher) Prefetch(ctx context.Context, rootFEN string) (prefetchResult, error) {
+	var (
+		result     prefetchResult
+		players    int64
+		cloudEvals int64
+		queryAlls  int64
+	)
+
+	walker := p.walker
+	walker.fetch = p.fetchRatings
+
+	err := walker.Walk(ctx, rootFEN, func(b bitboard.Board, moves []string, _ []lichess.OpeningExplorerMove) error {
+		fen := b.FEN()
+
+		var wg sync.WaitGroup
+		wg.Add(2)
+
+		if p.player != nil {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := p.player(ctx, b, moves); err == nil {
+					atomic.AddInt64(&players, 1)
+				}
+			}()
+		}
+
+		go func() {
+			defer wg.Done()
+			if err := p.cloudEval(ctx, fen); err == nil {
+				atomic.AddInt64(&cloudEvals, 1)
+			}
+		}()
+
+		go func() {
+			defer wg.Done()
+			if err := p.queryAll(ctx, fen); err == nil {
+				atomic.AddInt64(&queryAlls, 1)
+			}
+		}()
+
+		wg.Wait()
+
+		result.Positions++
+		return ctx.Err()
+	})
+
+	result.Players = int(players)
+	result.CloudEvals = int(cloudEvals)
+	result.QueryAlls = int(queryAlls)
+
+	if err != nil {
+		return result, xerrors.Errorf("%w", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"automock/bitboard"
+	"automock/config"
+	"automock/lichess"
+)
+
+func TestParsePrefetch(t *testing.T) {
+	cases := []struct {
+		name    string
+		line    string
+		want    prefetchArgs
+		wantErr bool
+	}{
+		{name: "defaults", line: "prefetch", want: prefetchArgs{Depth: defaultPrefetchDepth, MinGames: defaultPrefetchMinGames}},
+		{name: "depth and mingames", line: "prefetch depth 4 mingames 1000", want: prefetchArgs{Depth: 4, MinGames: 1000}},
+		{name: "mingames only", line: "prefetch mingames 0", want: prefetchArgs{Depth: defaultPrefetchDepth, MinGames: 0}},
+		{name: "missing argument", line: "prefetch depth", wantErr: true},
+		{name: "depth 0", line: "prefetch depth 0", wantErr: true},
+		{name: "not an int", line: "prefetch mingames many", wantErr: true},
+		{name: "unknown", line: "prefetch width 3", wantErr: true},
+		{name: "stop", line: "prefetch stop", want: prefetchArgs{Stop: true}},
+		{name: "stop with arguments", line: "prefetch stop depth 3", wantErr: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// act
+			got, err := parsePrefetch(c.line)
+
+			// assert
+			if (err != nil) != c.wantErr {
+				t.Fatalf("wantErr: %v got: %v", c.wantErr, err)
+			}
+			if c.want != got {
+				t.Errorf("want: %+v got: %+v", c.want, got)
+			}
+		})
+	}
+}
+
+func TestPrefetcher_Prefetch(t *testing.T) {
+	// arrange
+	// keyed by the moves played from the start position; the game has already played e2e4
+	tree := map[string][]lichess.OpeningExplorerMove{
+		"e2e4":           {{UCI: "c7c5", White: 300, Black: 200}, {UCI: "e7e5", White: 200, Black: 200}, {UCI: "a7a6", White: 1, Black: 1}},
+		"e2e4,c7c5":      {{UCI: "g1f3", White: 150, Black: 150}},
+		"e2e4,e7e5":      {{UCI: "g1f3", White: 150, Black: 150}},
+		"e2e4,c7c5,g1f3": {{UCI: "d7d6", White: 100, Black: 100}},
+	}
+
+	e := NewEngine(config.Config{})
+	e.handlePosition("position startpos moves e2e4")
+	startFEN, moves := e.readPosition()
+
+	p := e.newPrefetcher(prefetchArgs{Depth: 2, MinGames: 100}, startFEN, moves)
+	p.walker.Progress = nil
+
+	var (
+		mtx       sync.Mutex
+		fetched   []string
+		evaluated []string
+	)
+	p.fetch = func(ctx context.Context, req lichess.OpeningExplorerRequest) (lichess.OpeningExplorerResponse, string, error) {
+		fetched = append(fetched, req.Play)
+		return lichess.OpeningExplorerResponse{Moves: tree[req.Play]}, "lichess_data", nil
+	}
+	p.cloudEval = func(ctx context.Context, fen string) error {
+		mtx.Lock()
+		evaluated = append(evaluated, fen)
+		mtx.Unlock()
+		return nil
+	}
+	p.queryAll = func(ctx context.Context, fen string) error {
+		return fmt.Errorf("unknown position")
+	}
+
+	// act
+	result, err := p.Prefetch(context.Background(), "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq - 0 1")
+
+	// assert
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantFetched := []string{"e2e4", "e2e4,c7c5", "e2e4,e7e5"}
+	if fmt.Sprint(wantFetched) != fmt.Sprint(fetched) {
+		t.Errorf("fetched want: %q got: %q", wantFetched, fetched)
+	}
+
+	wantEvaluated := []string{
+		"rnbqkbnr/pp1ppppp/8/2p5/4P3/8/PPPP1PPP/RNBQKBNR w KQkq - 0 2",
+		"rnbqkbnr/pppp1ppp/8/4p3/4P3/8/PPPP1PPP/RNBQKBNR w KQkq - 0 2",
+		"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq - 0 1",
+	}
+	sort.Strings(evaluated)
+	if fmt.Sprint(wantEvaluated) != fmt.Sprint(evaluated) {
+		t.Errorf("evaluated want: %q got: %q", wantEvaluated, evaluated)
+	}
+
+	want := prefetchResult{Positions: 3, CloudEvals: 3, QueryAlls: 0}
+	if want != result {
+		t.Errorf("want: %+v got: %+v", want, result)
+	}
+}
+
+func TestPrefetcher_PrefetchLimitStrengthAndPlayer(t *testing.T) {
+	// arrange
+	e := NewEngine(config.Config{})
+	for name, value := range map[string]string{"UCI_LimitStrength": "true", "UCI_Elo": "1650", "Lichess_Player": "someone"} {
+		uciOption, _ := e.findUCIOption(name)
+		if err := uciOption.Set(e, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	startFEN, moves := e.readPosition()
+
+	p := e.newPrefetcher(prefetchArgs{Depth: 2, MinGames: 100}, startFEN, moves)
+	p.walker.Progress = nil
+
+	var (
+		mtx     sync.Mutex
+		fetched []string
+		players []string
+	)
+	p.fetch = func(ctx context.Context, req lichess.OpeningExplorerRequest) (lichess.OpeningExplorerResponse, string, error) {
+		fetched = append(fetched, req.Play+"@"+req.Ratings.String())
+		// each bucket alone is below MinGames, together they're above it
+		if req.Play == "" {
+			return lichess.OpeningExplorerResponse{Moves: []lichess.OpeningExplorerMove{{UCI: "e2e4", White: 30, Black: 30}}}, "lichess_data", nil
+		}
+		return lichess.OpeningExplorerResponse{}, "lichess_data", nil
+	}
+	p.player = func(ctx context.Context, b bitboard.Board, moves []string) error {
+		mtx.Lock()
+		players = append(players, b.ActiveColor.String()+":"+strings.Join(moves, ","))
+		mtx.Unlock()
+		return nil
+	}
+	p.cloudEval = func(ctx context.Context, fen string) error { return nil }
+	p.queryAll = func(ctx context.Context, fen string) error { return nil }
+
+	// act
+	result, err := p.Prefetch(context.Background(), bitboard.StartPosBoard().FEN())
+
+	// assert
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the buckets 'go' picks from, one at a time
+	wantFetched := []string{"@1400", "@1600", "e2e4@1400", "e2e4@1600"}
+	if fmt.Sprint(wantFetched) != fmt.Sprint(fetched) {
+		t.Errorf("fetched want: %q got: %q", wantFetched, fetched)
+	}
+
+	sort.Strings(players)
+	wantPlayers := []string{"b:e2e4", "w:"}
+	if fmt.Sprint(wantPlayers) != fmt.Sprint(players) {
+		t.Errorf("players want: %q got: %q", wantPlayers, players)
+	}
+
+	if result.Players != 2 {
+		t.Errorf("players want: 2 got: %d", result.Players)
+	}
+}
+
+func TestPrefetcher_LimitStrengthDatabases(t *testing.T) {
+	cases := []struct {
+		name     string
+		database string
+		// source is what the fake Lichess_Database lookup answers with
+		source      string
+		wantFetched []string
+		wantTotal   int
+	}{
+		{name: "lichess adds up the buckets", database: DatabaseLichess, source: "lichess_data", wantFetched: []string{"1400", "1600"}, wantTotal: 120},
+		{name: "masters isn't split by rating", database: DatabaseMasters, source: "lichess_masters", wantFetched: []string{"1400,1600"}, wantTotal: 60},
+		{name: "blend from masters isn't added up", database: DatabaseBlend, source: "lichess_masters", wantFetched: []string{"1400", "1600"}, wantTotal: 60},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// arrange
+			e := NewEngine(config.Config{})
+			for name, value := range map[string]string{"UCI_LimitStrength": "true", "UCI_Elo": "1650", "Lichess_Database": c.database} {
+				uciOption, _ := e.findUCIOption(name)
+				if err := uciOption.Set(e, value); err != nil {
+					t.Fatal(err)
+				}
+			}
+			startFEN, moves := e.readPosition()
+
+			p := e.newPrefetcher(prefetchArgs{Depth: 1, MinGames: 100}, startFEN, moves)
+
+			var fetched []string
+			p.fetch = func(ctx context.Context, req lichess.OpeningExplorerRequest) (lichess.OpeningExplorerResponse, string, error) {
+				fetched = append(fetched, req.Ratings.String())
+				return lichess.OpeningExplorerResponse{Moves: []lichess.OpeningExplorerMove{{UCI: "e2e4", White: 30, Black: 30}}}, c.source, nil
+			}
+
+			// act
+			resp, err := p.fetchRatings(context.Background(), lichess.OpeningExplorerRequest{FEN: startFEN, Ratings: lichess.Ratings{lichess.R1400, lichess.R1600}})
+
+			// assert
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprint(c.wantFetched) != fmt.Sprint(fetched) {
+				t.Errorf("fetched want: %q got: %q", c.wantFetched, fetched)
+			}
+			if len(resp.Moves) != 1 || c.wantTotal != resp.Moves[0].Total() {
+				t.Errorf("e2e4 games want: %d got: %+v", c.wantTotal, resp.Moves)
+			}
+		})
+	}
+}
+
+func TestEngine_StopLeavesPrefetchRunning(t *testing.T) {
+	// arrange
+	e := NewEngine(config.Config{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	e.cancelPrefetch = cancel
+
+	// act
+	e.ParseInput("stop")
+	afterStop := ctx.Err()
+	e.ParseInput("prefetch stop")
+
+	// assert
+	if afterStop != nil {
+		t.Errorf("want 'stop' to leave the prefetch running")
+	}
+	if ctx.Err() == nil {
+		t.Errorf("want 'prefetch stop' to end the prefetch")
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// maxRandomSeed keeps generated seeds within the Random_Seed spin range, so a seed from the log can be
+// set again to replay a game.
+const maxRandomSeed = 2147483647
+
+// lockedSource is a rand.Source that's safe for concurrent use, like the one behind the math/rand
+// top-level functions.
+type lockedSource struct {
+	mtx sync.Mutex
+	src rand.Source64
+}
+
+func newLockedSource(seed int64) *lockedSource {
+	return &lockedSource{src: rand.NewSource(seed).(rand.Source64)}
+}
+
+func (s *lockedSource) Int63() int64 {
+	s.mtx.Lock()
+	n := s.src.Int63()
+	s.mtx.Unlock()
+	return n
+}
+
+func (s *lockedSource) Uint64() uint64 {
+	s.mtx.Lock()
+	n := s.src.Uint64()
+	s.mtx.Unlock()
+	return n
+}
+
+func (s *lockedSource) Seed(seed int64) {
+	s.mtx.Lock()
+	s.src.Seed(seed)
+	s.mtx.Unlock()
+}
+
+// clockSeed returns a seed in [1, maxRandomSeed] for when Random_Seed is 0.
+func clockSeed() int64 {
+	return time.Now().UnixNano()%maxRandomSeed + 1
+}
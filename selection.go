@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"automock/bitboard"
+	"automock/lichess"
+)
+
+const (
+	SelectionProportional = "proportional"
+	SelectionTemperature  = "temperature"
+	SelectionTopN         = "top_n"
+	SelectionMostPopular  = "most_popular"
+	SelectionWinRate      = "win_rate"
+)
+
+var validSelectionPolicies = []string{
+	SelectionProportional,
+	SelectionTemperature,
+	SelectionTopN,
+	SelectionMostPopular,
+	SelectionWinRate,
+}
+
+// SelectionPolicy assigns a sampling weight to each explorer move. Moves with a weight of 0 are never chosen.
+type SelectionPolicy interface {
+	Name() string
+	Weights(moves []lichess.OpeningExplorerMove, side bitboard.Color) []float64
+}
+
+// newSelectionPolicy returns the policy for a Move_Selection combo value. temperature is in hundredths,
+// e.g. 150 for T=1.5.
+func newSelectionPolicy(name string, temperature, topN int) SelectionPolicy {
+	switch name {
+	case SelectionTemperature:
+		return temperaturePolicy{Temperature: float64(temperature) / 100}
+	case SelectionTopN:
+		return topNPolicy{N: topN}
+	case SelectionMostPopular:
+		return mostPopularPolicy{}
+	case SelectionWinRate:
+		return winRatePolicy{}
+	default:
+		return proportionalPolicy{}
+	}
+}
+
+// proportionalPolicy samples in proportion to the number of games a move was played.
+type proportionalPolicy struct{}
+
+func (p proportionalPolicy) Name() string {
+	return SelectionProportional
+}
+
+func (p proportionalPolicy) Weights(moves []lichess.OpeningExplorerMove, _ bitboard.Color) []float64 {
+	weights := make([]float64, len(moves))
+	for i, move := range moves {
+		weights[i] = float64(move.Total())
+	}
+	return weights
+}
+
+// temperaturePolicy raises game counts, relative to the most played move's, to the power 1/T. T < 1
+// favors popular moves, T > 1 flattens the distribution toward sidelines, and T = 1 is the same as
+// proportionalPolicy.
+type temperaturePolicy struct {
+	Temperature float64
+}
+
+func (p temperaturePolicy) Name() string {
+	return fmt.Sprintf("%s:%.2f", SelectionTemperature, p.Temperature)
+}
+
+func (p temperaturePolicy) Weights(moves []lichess.OpeningExplorerMove, side bitboard.Color) []float64 {
+	if p.Temperature <= 0 {
+		return mostPopularPolicy{}.Weights(moves, side)
+	}
+
+	var maxTotal int
+	for _, move := range moves {
+		if move.Total() > maxTotal {
+			maxTotal = move.Total()
+		}
+	}
+
+	// relative to the most popular move, so a low temperature can't overflow to +Inf
+	weights := make([]float64, len(moves))
+	if maxTotal == 0 {
+		return weights
+	}
+	for i, move := range moves {
+		weights[i] = math.Pow(float64(move.Total())/float64(maxTotal), 1/p.Temperature)
+	}
+	return weights
+}
+
+// topNPolicy samples proportionally from only the N most popular moves.
+type topNPolicy struct {
+	N int
+}
+
+func (p topNPolicy) Name() string {
+	return fmt.Sprintf("%s:%d", SelectionTopN, p.N)
+}
+
+func (p topNPolicy) Weights(moves []lichess.OpeningExplorerMove, _ bitboard.Color) []float64 {
+	idx := make([]int, len(moves))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(i, j int) bool {
+		return moves[idx[i]].Total() > moves[idx[j]].Total()
+	})
+
+	weights := make([]float64, len(moves))
+	for rank, i := range idx {
+		if rank >= p.N {
+			break
+		}
+		weights[i] = float64(moves[i].Total())
+	}
+	return weights
+}
+
+// mostPopularPolicy always plays the move with the most games.
+type mostPopularPolicy struct{}
+
+func (p mostPopularPolicy) Name() string {
+	return SelectionMostPopular
+}
+
+func (p mostPopularPolicy) Weights(moves []lichess.OpeningExplorerMove, side bitboard.Color) []float64 {
+	return topNPolicy{N: 1}.Weights(moves, side)
+}
+
+// winRatePolicy weights each move by the side to move's score from it: wins plus half the draws.
+// Popular moves still dominate, but moves that score badly for us are played less often.
+type winRatePolicy struct{}
+
+func (p winRatePolicy) Name() string {
+	return SelectionWinRate
+}
+
+func (p winRatePolicy) Weights(moves []lichess.OpeningExplorerMove, side bitboard.Color) []float64 {
+	weights := make([]float64, len(moves))
+	for i, move := range moves {
+		wins := move.White
+		if side == bitboard.Black {
+			wins = move.Black
+		}
+		weights[i] = float64(wins) + float64(move.Draws)/2
+	}
+	return weights
+}
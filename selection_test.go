@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+
+	"automock/bitboard"
+	"automock/lichess"
+)
+
+// selectionTestResponse is the position after 1. e4 c5 2. Nf3, trimmed to four moves.
+var selectionTestResponse = lichess.OpeningExplorerResponse{
+	Moves: []lichess.OpeningExplorerMove{
+		{UCI: "d7d6", SAN: "d6", White: 450, Draws: 50, Black: 500},
+		{UCI: "b8c6", SAN: "Nc6", White: 300, Draws: 40, Black: 260},
+		{UCI: "e7e6", SAN: "e6", White: 150, Draws: 20, Black: 230},
+		{UCI: "g7g6", SAN: "g6", White: 60, Draws: 0, Black: 40},
+	},
+}
+
+func TestSelectionPolicy_Weights(t *testing.T) {
+	cases := []struct {
+		name   string
+		policy SelectionPolicy
+		side   bitboard.Color
+		want   []float64
+	}{
+		{
+			name:   "proportional",
+			policy: proportionalPolicy{},
+			side:   bitboard.Black,
+			want:   []float64{1000, 600, 400, 100},
+		},
+		{
+			name:   "temperature 1 is proportional",
+			policy: temperaturePolicy{Temperature: 1},
+			side:   bitboard.Black,
+			want:   []float64{1, 0.6, 0.4, 0.1},
+		},
+		{
+			name:   "temperature 0.5 squares",
+			policy: temperaturePolicy{Temperature: 0.5},
+			side:   bitboard.Black,
+			want:   []float64{1, 0.36, 0.16, 0.01},
+		},
+		{
+			name:   "temperature 0 is most popular",
+			policy: temperaturePolicy{Temperature: 0},
+			side:   bitboard.Black,
+			want:   []float64{1000, 0, 0, 0},
+		},
+		{
+			name:   "top 2",
+			policy: topNPolicy{N: 2},
+			side:   bitboard.Black,
+			want:   []float64{1000, 600, 0, 0},
+		},
+		{
+			name:   "top n larger than moves",
+			policy: topNPolicy{N: 10},
+			side:   bitboard.Black,
+			want:   []float64{1000, 600, 400, 100},
+		},
+		{
+			name:   "most popular",
+			policy: mostPopularPolicy{},
+			side:   bitboard.Black,
+			want:   []float64{1000, 0, 0, 0},
+		},
+		{
+			name:   "win rate black",
+			policy: winRatePolicy{},
+			side:   bitboard.Black,
+			want:   []float64{525, 280, 240, 40},
+		},
+		{
+			name:   "win rate white",
+			policy: winRatePolicy{},
+			side:   bitboard.White,
+			want:   []float64{475, 320, 160, 60},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// act
+			got := c.policy.Weights(selectionTestResponse.Moves, c.side)
+
+			// assert
+			if len(c.want) != len(got) {
+				t.Fatalf("want: %v got: %v", c.want, got)
+			}
+			for i := range c.want {
+				if math.Abs(c.want[i]-got[i]) > 1e-6 {
+					t.Errorf("want: %v got: %v", c.want, got)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestTemperaturePolicy_LowTemperature(t *testing.T) {
+	// arrange
+	moves := []lichess.OpeningExplorerMove{
+		{UCI: "e2e4", White: 2_000_000, Draws: 300_000, Black: 1_900_000},
+		{UCI: "d2d4", White: 1_500_000, Draws: 250_000, Black: 1_400_000},
+		{UCI: "b2b3", White: 20_000, Draws: 2_000, Black: 21_000},
+	}
+	policy := temperaturePolicy{Temperature: 0.01}
+	rnd := rand.New(rand.NewSource(1))
+
+	// act
+	weights := policy.Weights(moves, bitboard.White)
+
+	// assert
+	for i, weight := range weights {
+		if math.IsInf(weight, 0) || math.IsNaN(weight) {
+			t.Fatalf("weight %d want finite got: %v", i, weight)
+		}
+	}
+	for n := 0; n < 100; n++ {
+		if idx := sampleIndex(weights, rnd); idx != 0 {
+			t.Fatalf("want the most popular move got: %s weights: %v", moves[idx].UCI, weights)
+		}
+	}
+}
+
+func TestExplorerCandidates(t *testing.T) {
+	cases := []struct {
+		name   string
+		policy SelectionPolicy
+		resp   lichess.OpeningExplorerResponse
+		want   []string
+	}{
+		{
+			name:   "most popular",
+			policy: mostPopularPolicy{},
+			resp:   selectionTestResponse,
+			want:   []string{"d7d6"},
+		},
+		{
+			name:   "top 2",
+			policy: topNPolicy{N: 2},
+			resp:   selectionTestResponse,
+			want:   []string{"d7d6", "b8c6"},
+		},
+		{
+			name:   "no games",
+			policy: proportionalPolicy{},
+			resp:   lichess.OpeningExplorerResponse{},
+			want:   nil,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// act
+			candidates := explorerCandidates(c.resp, c.policy, bitboard.Black, "lichess_data")
+
+			// assert
+			var got []string
+			for _, candidate := range candidates {
+				got = append(got, candidate.UCI)
+				if candidate.Source != "lichess_data" || candidate.Weight <= 0 {
+					t.Errorf("want source lichess_data and a positive weight, got: %+v", candidate)
+				}
+			}
+			if fmt.Sprint(c.want) != fmt.Sprint(got) {
+				t.Errorf("want: %v got: %v", c.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,209 @@
+// Package store is a persistent, timestamped record of explorer lookups. Entries are keyed by the
+// normalized request, so asking for the same position through a different move order, or with the
+// query parameters in a different order, finds the same entry.
+package store
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"golang.org/x/xerrors"
+)
+
+const (
+	StatusOK    = "ok"
+	StatusEmpty = "empty" // the source had no moves for the position
+)
+
+var entriesBucket = []byte("entries")
+
+// Key is a normalized request. FEN is the position's bitboard.Board.FENKey, lists are sorted and comma
+// separated, defaults are filled in, and fields that don't apply to the database are left empty.
+type Key struct {
+	Database string `json:"database"`
+	Variant  string `json:"variant,omitempty"`
+	FEN      string `json:"fen"`
+	Speeds   string `json:"speeds,omitempty"`
+	Ratings  string `json:"ratings,omitempty"`
+	Modes    string `json:"modes,omitempty"`
+	Since    string `json:"since,omitempty"`
+	Until    string `json:"until,omitempty"`
+	// Player is "name/color" for the player database.
+	Player string `json:"player,omitempty"`
+	// Moves, TopGames and RecentGames are how many of each the response lists.
+	Moves       int  `json:"moves,omitempty"`
+	TopGames    int  `json:"top_games,omitempty"`
+	RecentGames int  `json:"recent_games,omitempty"`
+	History     bool `json:"history,omitempty"`
+}
+
+type Entry struct {
+	Key Key `json:"key"`
+	// Source is the endpoint the response was fetched from, e.g. explorer.lichess.ovh/lichess.
+	Source    string          `json:"source"`
+	Status    string          `json:"status"`
+	FetchedAt time.Time       `json:"fetched_at"`
+	Response  json.RawMessage `json:"response"`
+}
+
+type Store struct {
+	db *bolt.DB
+}
+
+// Open opens or creates the store at fileName. It fails after a second if another process has it open.
+func Open(fileName string) (*Store, error) {
+	db, err := bolt.Open(fileName, 0644, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, xerrors.Errorf("store '%s': %w", fileName, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(entriesBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, xerrors.Errorf("store '%s': %w", fileName, err)
+	}
+
+	return &Store{db: db}, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Put adds or replaces the entry for entry.Key.
+func (s *Store) Put(entry Entry) error {
+	k, err := encodeKey(entry.Key)
+	if err != nil {
+		return xerrors.Errorf("%w", err)
+	}
+
+	v, err := json.Marshal(entry)
+	if err != nil {
+		return xerrors.Errorf("%w", err)
+	}
+
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(entriesBucket).Put(k, v)
+	})
+	if err != nil {
+		return xerrors.Errorf("%w", err)
+	}
+
+	return nil
+}
+
+// Get returns the entry for key, however old it is.
+func (s *Store) Get(key Key) (Entry, bool, error) {
+	k, err := encodeKey(key)
+	if err != nil {
+		return Entry{}, false, xerrors.Errorf("%w", err)
+	}
+
+	var (
+		entry Entry
+		found bool
+	)
+
+	err = s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(entriesBucket).Get(k)
+		if v == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(v, &entry)
+	})
+	if err != nil {
+		return Entry{}, false, xerrors.Errorf("%w", err)
+	}
+
+	return entry, found, nil
+}
+
+// GetFresh returns the entry for key if it was fetched within maxAge.
+func (s *Store) GetFresh(key Key, maxAge time.Duration) (Entry, bool, error) {
+	entry, ok, err := s.Get(key)
+	if err != nil || !ok {
+		return Entry{}, false, err
+	}
+
+	if time.Since(entry.FetchedAt) > maxAge {
+		return Entry{}, false, nil
+	}
+
+	return entry, true, nil
+}
+
+// List calls fn for each entry whose source starts with source. An empty source lists everything.
+func (s *Store) List(source string, fn func(entry Entry) error) error {
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(entriesBucket).ForEach(func(k, v []byte) error {
+			var entry Entry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return xerrors.Errorf("entry '%s': %w", string(k), err)
+			}
+			if !strings.HasPrefix(entry.Source, source) {
+				return nil
+			}
+			return fn(entry)
+		})
+	})
+	if err != nil {
+		return xerrors.Errorf("%w", err)
+	}
+
+	return nil
+}
+
+// Purge deletes the entries whose source starts with source and that were fetched before before. A zero
+// before deletes them regardless of age. It returns the number of entries deleted.
+func (s *Store) Purge(source string, before time.Time) (int, error) {
+	var deleted int
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(entriesBucket)
+
+		var keys [][]byte
+		err := bucket.ForEach(func(k, v []byte) error {
+			var entry Entry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return xerrors.Errorf("entry '%s': %w", string(k), err)
+			}
+			if !strings.HasPrefix(entry.Source, source) {
+				return nil
+			}
+			if !before.IsZero() && !entry.FetchedAt.Before(before) {
+				return nil
+			}
+			keys = append(keys, k)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		// a bucket can't be modified while iterating it
+		for _, k := range keys {
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+		}
+		deleted = len(keys)
+
+		return nil
+	})
+	if err != nil {
+		return 0, xerrors.Errorf("%w", err)
+	}
+
+	return deleted, nil
+}
+
+// encodeKey relies on encoding/json writing struct fields in declaration order.
+func encodeKey(key Key) ([]byte, error) {
+	return json.Marshal(key)
+}
@@ -0,0 +1,137 @@
+package store
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStore(t *testing.T) {
+	// arrange
+	s, err := Open(filepath.Join(t.TempDir(), "automock.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	now := time.Now()
+	startPos := "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq -"
+
+	entries := []Entry{
+		{
+			Key:       Key{Database: "lichess", FEN: startPos, Speeds: "blitz", Ratings: "1600,1800"},
+			Source:    "explorer.lichess.ovh/lichess",
+			Status:    StatusOK,
+			FetchedAt: now.Add(-2 * 24 * time.Hour),
+			Response:  json.RawMessage(`{"white":1}`),
+		},
+		{
+			Key:       Key{Database: "lichess", FEN: startPos, Speeds: "rapid", Ratings: "1600,1800"},
+			Source:    "explorer.lichess.ovh/lichess",
+			Status:    StatusOK,
+			FetchedAt: now.Add(-40 * 24 * time.Hour),
+			Response:  json.RawMessage(`{"white":2}`),
+		},
+		{
+			Key:       Key{Database: "masters", FEN: startPos, Since: "1952"},
+			Source:    "explorer.lichess.ovh/masters",
+			Status:    StatusEmpty,
+			FetchedAt: now,
+			Response:  json.RawMessage(`{}`),
+		},
+	}
+	for _, entry := range entries {
+		if err := s.Put(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		name   string
+		key    Key
+		maxAge time.Duration
+		want   string
+		found  bool
+	}{
+		{name: "fresh", key: entries[0].Key, maxAge: 7 * 24 * time.Hour, want: `{"white":1}`, found: true},
+		{name: "stale", key: entries[1].Key, maxAge: 7 * 24 * time.Hour, found: false},
+		{name: "stale within max age", key: entries[1].Key, maxAge: 60 * 24 * time.Hour, want: `{"white":2}`, found: true},
+		{name: "different request", key: Key{Database: "lichess", FEN: startPos, Speeds: "bullet"}, maxAge: time.Hour, found: false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// act
+			got, found, err := s.GetFresh(c.key, c.maxAge)
+
+			// assert
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.found != found {
+				t.Fatalf("found want: %v got: %v", c.found, found)
+			}
+			if c.found && c.want != string(got.Response) {
+				t.Errorf("want: %s got: %s", c.want, string(got.Response))
+			}
+		})
+	}
+}
+
+func TestStore_ListPurge(t *testing.T) {
+	// arrange
+	s, err := Open(filepath.Join(t.TempDir(), "automock.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	now := time.Now()
+	puts := []Entry{
+		{Key: Key{Database: "lichess", FEN: "a"}, Source: "explorer.lichess.ovh/lichess", FetchedAt: now.Add(-48 * time.Hour)},
+		{Key: Key{Database: "lichess", FEN: "b"}, Source: "explorer.lichess.ovh/lichess", FetchedAt: now},
+		{Key: Key{Database: "masters", FEN: "a"}, Source: "explorer.lichess.ovh/masters", FetchedAt: now.Add(-48 * time.Hour)},
+	}
+	for _, entry := range puts {
+		if err := s.Put(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	count := func(source string) int {
+		var n int
+		if err := s.List(source, func(Entry) error { n++; return nil }); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	// act + assert
+	if want, got := 3, count("explorer.lichess.ovh"); want != got {
+		t.Errorf("list all want: %d got: %d", want, got)
+	}
+	if want, got := 2, count("explorer.lichess.ovh/lichess"); want != got {
+		t.Errorf("list lichess want: %d got: %d", want, got)
+	}
+
+	deleted, err := s.Purge("explorer.lichess.ovh/lichess", now.Add(-24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 1, deleted; want != got {
+		t.Errorf("purge by age want: %d got: %d", want, got)
+	}
+
+	deleted, err = s.Purge("explorer.lichess.ovh/masters", time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 1, deleted; want != got {
+		t.Errorf("purge by source want: %d got: %d", want, got)
+	}
+
+	if want, got := 1, count(""); want != got {
+		t.Errorf("remaining want: %d got: %d", want, got)
+	}
+}
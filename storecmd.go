@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"automock/config"
+	"automock/store"
+)
+
+type storeLsCmd struct {
+	Source string `help:"Only list entries whose source starts with this, e.g. explorer.lichess.ovh/masters."`
+}
+
+func (c storeLsCmd) Run(cfg config.Config) error {
+	s, err := store.Open(cfg.StoreFile)
+	if err != nil {
+		return xerrors.Errorf("%w", err)
+	}
+	defer s.Close()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "FETCHED\tSTATUS\tSOURCE\tFEN\tSPEEDS\tRATINGS\tSINCE\tUNTIL\tPLAYER")
+
+	err = s.List(c.Source, func(entry store.Entry) error {
+		key := entry.Key
+		_, err := fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			entry.FetchedAt.Format(time.RFC3339), entry.Status, entry.Source,
+			key.FEN, key.Speeds, key.Ratings, key.Since, key.Until, key.Player,
+		)
+		return err
+	})
+	if err != nil {
+		return xerrors.Errorf("%w", err)
+	}
+
+	return w.Flush()
+}
+
+type storePurgeCmd struct {
+	Source        string `help:"Only delete entries whose source starts with this, e.g. explorer.lichess.ovh/masters."`
+	OlderThanDays int    `help:"Only delete entries fetched more than this many days ago. 0 deletes regardless of age."`
+}
+
+func (c storePurgeCmd) Run(cfg config.Config) error {
+	s, err := store.Open(cfg.StoreFile)
+	if err != nil {
+		return xerrors.Errorf("%w", err)
+	}
+	defer s.Close()
+
+	var before time.Time
+	if c.OlderThanDays > 0 {
+		before = time.Now().Add(-time.Duration(c.OlderThanDays) * 24 * time.Hour)
+	}
+
+	deleted, err := s.Purge(c.Source, before)
+	if err != nil {
+		return xerrors.Errorf("%w", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "store purge: deleted %d entries\n", deleted)
+	return nil
+}
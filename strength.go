@@ -0,0 +1,138 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"strconv"
+
+	"automock/extengine"
+	"automock/lichess"
+)
+
+const (
+	minUCIElo     = 600
+	maxUCIElo     = 3000
+	defaultUCIElo = 1500
+
+	// the external engine's Skill Level is spread over Stockfish's UCI_Elo range
+	skillMinElo = 1320
+	skillMaxElo = 3190
+
+	// limitStrengthMultiPV is the number of engine lines sampled from when the engine can't limit its
+	// own strength
+	limitStrengthMultiPV = 4
+)
+
+// ratingBucketElo is the typical rating of the players in each explorer rating bucket.
+var ratingBucketElo = []struct {
+	rating lichess.Rating
+	elo    int
+}{
+	{rating: lichess.R0, elo: 800},
+	{rating: lichess.R1000, elo: 1100},
+	{rating: lichess.R1200, elo: 1300},
+	{rating: lichess.R1400, elo: 1500},
+	{rating: lichess.R1600, elo: 1700},
+	{rating: lichess.R1800, elo: 1900},
+	{rating: lichess.R2000, elo: 2100},
+	{rating: lichess.R2200, elo: 2350},
+	{rating: lichess.R2500, elo: 2650},
+}
+
+// ratingBuckets returns the explorer rating buckets either side of elo, and how much of the way from the
+// lower to the upper bucket elo is. Below the first bucket or above the last, both are the same bucket.
+func ratingBuckets(elo int) (lichess.Rating, lichess.Rating, float64) {
+	first, last := ratingBucketElo[0], ratingBucketElo[len(ratingBucketElo)-1]
+	if elo <= first.elo {
+		return first.rating, first.rating, 0
+	}
+	if elo >= last.elo {
+		return last.rating, last.rating, 0
+	}
+
+	for i := 1; i < len(ratingBucketElo); i++ {
+		lower, upper := ratingBucketElo[i-1], ratingBucketElo[i]
+		if elo < upper.elo {
+			return lower.rating, upper.rating, float64(elo-lower.elo) / float64(upper.elo-lower.elo)
+		}
+	}
+
+	panic("unreachable")
+}
+
+// pickRatingBucket picks the lower or upper bucket for elo, the upper with probability by how close elo is
+// to it. Over a game the moves then follow the interpolated distribution of the two buckets.
+func pickRatingBucket(elo int, rnd *rand.Rand) lichess.Rating {
+	lower, upper, upperWeight := ratingBuckets(elo)
+	if rnd.Float64() < upperWeight {
+		return upper
+	}
+	return lower
+}
+
+// limitStrengthRatings are the rating buckets UCI_Elo is interpolated between.
+func limitStrengthRatings(elo int) lichess.Ratings {
+	lower, upper, _ := ratingBuckets(elo)
+	if lower == upper {
+		return lichess.Ratings{lower}
+	}
+	return lichess.Ratings{lower, upper}
+}
+
+// limitStrengthScoreScale is the centipawn loss that makes an engine line e times less likely at elo, for
+// engines that can't limit their own strength.
+func limitStrengthScoreScale(elo int) int {
+	scale := scoreWeightScale * (maxUCIElo - elo) / 500
+	if scale < 10 {
+		return 10
+	}
+	return scale
+}
+
+// externalEngineLimitsStrength returns true if the external engine has an option to play at UCI_Elo.
+func externalEngineLimitsStrength(extEngine *extengine.ExternalEngine) bool {
+	return (extEngine.HasOption("UCI_LimitStrength") && extEngine.HasOption("UCI_Elo")) || extEngine.HasOption("Skill Level")
+}
+
+// externalEngineStrengthOptions sets the external engine's own UCI_Elo, or failing that its Skill Level,
+// from UCI_LimitStrength and UCI_Elo. A Skill Level is only reset if an earlier game limited it.
+func externalEngineStrengthOptions(extEngine *extengine.ExternalEngine, limitStrength bool, elo int, wasLimited bool) []extengine.SetOption {
+	switch {
+	case extEngine.HasOption("UCI_LimitStrength") && extEngine.HasOption("UCI_Elo"):
+		if !limitStrength {
+			return []extengine.SetOption{{Name: "UCI_LimitStrength", Value: "false"}}
+		}
+		if min, max, ok := extEngine.SpinRange("UCI_Elo"); ok {
+			elo = clamp(elo, min, max)
+		}
+		return []extengine.SetOption{
+			{Name: "UCI_LimitStrength", Value: "true"},
+			{Name: "UCI_Elo", Value: strconv.Itoa(elo)},
+		}
+	case extEngine.HasOption("Skill Level"):
+		min, max, ok := extEngine.SpinRange("Skill Level")
+		if !ok {
+			min, max = 0, 20
+		}
+		if !limitStrength {
+			if !wasLimited {
+				return nil
+			}
+			return []extengine.SetOption{{Name: "Skill Level", Value: strconv.Itoa(max)}}
+		}
+		skill := min + int(math.Round(float64((elo-skillMinElo)*(max-min))/(skillMaxElo-skillMinElo)))
+		return []extengine.SetOption{{Name: "Skill Level", Value: strconv.Itoa(clamp(skill, min, max))}}
+	default:
+		return nil
+	}
+}
+
+func clamp(n, min, max int) int {
+	if n < min {
+		return min
+	}
+	if n > max {
+		return max
+	}
+	return n
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"automock/lichess"
+)
+
+func TestRatingBuckets(t *testing.T) {
+	cases := []struct {
+		name            string
+		elo             int
+		wantLower       lichess.Rating
+		wantUpper       lichess.Rating
+		wantUpperWeight float64
+	}{
+		{name: "below the first bucket", elo: 600, wantLower: lichess.R0, wantUpper: lichess.R0},
+		{name: "above the last bucket", elo: 3000, wantLower: lichess.R2500, wantUpper: lichess.R2500},
+		{name: "on a bucket", elo: 1500, wantLower: lichess.R1400, wantUpper: lichess.R1600},
+		{name: "between buckets", elo: 1650, wantLower: lichess.R1400, wantUpper: lichess.R1600, wantUpperWeight: 0.75},
+		{name: "wide bucket", elo: 2500, wantLower: lichess.R2200, wantUpper: lichess.R2500, wantUpperWeight: 0.5},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// act
+			lower, upper, upperWeight := ratingBuckets(c.elo)
+
+			// assert
+			if c.wantLower != lower || c.wantUpper != upper || math.Abs(c.wantUpperWeight-upperWeight) > 1e-9 {
+				t.Errorf("want: %v, %v, %v got: %v, %v, %v", c.wantLower, c.wantUpper, c.wantUpperWeight, lower, upper, upperWeight)
+			}
+		})
+	}
+}
+
+func TestPickRatingBucket(t *testing.T) {
+	// arrange
+	rnd := rand.New(rand.NewSource(1))
+	const n = 10000
+
+	// act
+	var upper int
+	for i := 0; i < n; i++ {
+		if pickRatingBucket(1650, rnd) == lichess.R1600 {
+			upper++
+		}
+	}
+
+	// assert
+	if got := float64(upper) / n; math.Abs(got-0.75) > 0.02 {
+		t.Errorf("upper bucket share want: 0.75 got: %.3f", got)
+	}
+}
+
+func TestLimitStrengthScoreScale(t *testing.T) {
+	cases := []struct {
+		elo  int
+		want int
+	}{
+		{elo: 600, want: 480},
+		{elo: 2500, want: 100},
+		{elo: 3000, want: 10},
+	}
+
+	for _, c := range cases {
+		// act
+		got := limitStrengthScoreScale(c.elo)
+
+		// assert
+		if c.want != got {
+			t.Errorf("elo %d want: %d got: %d", c.elo, c.want, got)
+		}
+	}
+}
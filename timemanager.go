@@ -0,0 +1,76 @@
+package main
+
+import (
+	"time"
+
+	"automock/bitboard"
+)
+
+const (
+	// defaultMoveBudget is used when "go" has no clock information, e.g. "go infinite" or "go depth 10".
+	defaultMoveBudget = 5000 * time.Millisecond
+	// maxMoveBudget caps the budget on long time controls; waiting longer doesn't get better answers from the APIs.
+	maxMoveBudget = 5000 * time.Millisecond
+	minMoveBudget = 50 * time.Millisecond
+
+	// moveOverhead is held back from the clock for GUI/network lag so we don't flag.
+	moveOverhead = 100 * time.Millisecond
+	// extEngineMargin is the time reserved for the external engine to report bestmove before the budget expires.
+	extEngineMargin = 100 * time.Millisecond
+
+	defaultMovesToGo = 30
+)
+
+// moveBudget returns how long a search may run before bestmove must be sent, based on the clock
+// and increment of the side to move.
+func moveBudget(args GoArgs, side bitboard.Color) time.Duration {
+	if args.MoveTime > 0 {
+		budget := time.Duration(args.MoveTime)*time.Millisecond - moveOverhead
+		if budget < minMoveBudget {
+			budget = minMoveBudget
+		}
+		return budget
+	}
+
+	remainingMS, incMS := args.WTime, args.WInc
+	if side == bitboard.Black {
+		remainingMS, incMS = args.BTime, args.BInc
+	}
+
+	if remainingMS == 0 {
+		return defaultMoveBudget
+	}
+
+	movesToGo := args.MovesToGo
+	if movesToGo == 0 || movesToGo > defaultMovesToGo {
+		movesToGo = defaultMovesToGo
+	}
+
+	remaining := time.Duration(remainingMS) * time.Millisecond
+	inc := time.Duration(incMS) * time.Millisecond
+
+	budget := remaining/time.Duration(movesToGo) + inc*3/4
+
+	// never plan to use more than what's left on the clock
+	if limit := remaining - moveOverhead; budget > limit {
+		budget = limit
+	}
+	if budget > maxMoveBudget {
+		budget = maxMoveBudget
+	}
+	if budget < minMoveBudget {
+		budget = minMoveBudget
+	}
+
+	return budget
+}
+
+// extEngineMoveTime returns the "go movetime" in milliseconds for the external engine so its
+// bestmove arrives within budget.
+func extEngineMoveTime(budget time.Duration) int {
+	moveTime := budget - extEngineMargin
+	if moveTime < 10*time.Millisecond {
+		moveTime = 10 * time.Millisecond
+	}
+	return int(moveTime.Milliseconds())
+}
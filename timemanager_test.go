@@ -0,0 +1,72 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"automock/bitboard"
+)
+
+func TestMoveBudget(t *testing.T) {
+	cases := []struct {
+		name string
+		args GoArgs
+		side bitboard.Color
+		want time.Duration
+	}{
+		{
+			name: "no clock",
+			args: GoArgs{Infinite: true},
+			side: bitboard.White,
+			want: defaultMoveBudget,
+		},
+		{
+			name: "movetime",
+			args: GoArgs{MoveTime: 1000},
+			side: bitboard.White,
+			want: 900 * time.Millisecond,
+		},
+		{
+			name: "1+0 white",
+			args: GoArgs{WTime: 60_000, BTime: 60_000},
+			side: bitboard.White,
+			want: 2000 * time.Millisecond,
+		},
+		{
+			name: "2+1 black uses black clock",
+			args: GoArgs{WTime: 120_000, BTime: 30_000, WInc: 1000, BInc: 1000},
+			side: bitboard.Black,
+			want: 1750 * time.Millisecond,
+		},
+		{
+			name: "classical capped",
+			args: GoArgs{WTime: 5_400_000, BTime: 5_400_000, WInc: 30_000, BInc: 30_000},
+			side: bitboard.White,
+			want: maxMoveBudget,
+		},
+		{
+			name: "movestogo",
+			args: GoArgs{WTime: 10_000, BTime: 10_000, MovesToGo: 5},
+			side: bitboard.White,
+			want: 2000 * time.Millisecond,
+		},
+		{
+			name: "nearly flagged",
+			args: GoArgs{WTime: 120, BTime: 60_000},
+			side: bitboard.White,
+			want: minMoveBudget,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// act
+			got := moveBudget(c.args, c.side)
+
+			// assert
+			if c.want != got {
+				t.Errorf("want: %v got: %v", c.want, got)
+			}
+		})
+	}
+}
@@ -2,9 +2,22 @@ package main
 
 import (
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"automock/httpcache"
+	"automock/lichess"
+	"automock/pgndb"
+	"automock/polyglot"
+	"automock/utils"
 )
 
+// UCIOption declares an option and how it's bound to an Engine field. "uci", "setoption" and "show"
+// are all generated from the list in Engine.UCIOptions.
 type UCIOption struct {
 	Name      string
 	Type      string
@@ -12,6 +25,11 @@ type UCIOption struct {
 	Min       int
 	Max       int
 	ComboVars []string
+
+	// Set validates value and stores it on the engine. The error is reported to the GUI as an info string.
+	Set func(e *Engine, value string) error
+	// Get returns the current value for "show".
+	Get func(e *Engine) string
 }
 
 func (o UCIOption) String() string {
@@ -23,7 +41,7 @@ func (o UCIOption) String() string {
 	var sb strings.Builder
 	sb.WriteString(fmt.Sprintf("option name %s type %s", o.Name, o.Type))
 	if o.Type != "button" {
-		sb.WriteString(fmt.Sprintf(" default %s", o.Default))
+		sb.WriteString(fmt.Sprintf(" default %s", defaultValue))
 	}
 
 	switch o.Type {
@@ -44,3 +62,294 @@ func (o UCIOption) String() string {
 	}
 	return sb.String()
 }
+
+func spinOption(name string, defaultValue, min, max int, field func(e *Engine) *int) UCIOption {
+	return UCIOption{
+		Name:    name,
+		Type:    "spin",
+		Default: strconv.Itoa(defaultValue),
+		Min:     min,
+		Max:     max,
+		Set: func(e *Engine, value string) error {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return xerrors.Errorf("'%s' is not an integer", value)
+			}
+			if n < min || n > max {
+				return xerrors.Errorf("%d is out of range, must be between %d and %d", n, min, max)
+			}
+			*field(e) = n
+			return nil
+		},
+		Get: func(e *Engine) string {
+			return strconv.Itoa(*field(e))
+		},
+	}
+}
+
+func checkOption(name string, defaultValue bool, field func(e *Engine) *bool) UCIOption {
+	return UCIOption{
+		Name:    name,
+		Type:    "check",
+		Default: strconv.FormatBool(defaultValue),
+		Set: func(e *Engine, value string) error {
+			switch strings.ToLower(value) {
+			case "true":
+				*field(e) = true
+			case "false":
+				*field(e) = false
+			default:
+				return xerrors.Errorf("'%s' is not true or false", value)
+			}
+			return nil
+		},
+		Get: func(e *Engine) string {
+			return strconv.FormatBool(*field(e))
+		},
+	}
+}
+
+func stringOption(name, defaultValue string, field func(e *Engine) *string) UCIOption {
+	return UCIOption{
+		Name:    name,
+		Type:    "string",
+		Default: defaultValue,
+		Set: func(e *Engine, value string) error {
+			*field(e) = value
+			return nil
+		},
+		Get: func(e *Engine) string {
+			return *field(e)
+		},
+	}
+}
+
+func comboOption(name, defaultValue string, vars []string, field func(e *Engine) *string) UCIOption {
+	return UCIOption{
+		Name:      name,
+		Type:      "combo",
+		Default:   defaultValue,
+		ComboVars: vars,
+		Set: func(e *Engine, value string) error {
+			canonical, err := comboValue(vars, value)
+			if err != nil {
+				return err
+			}
+			*field(e) = canonical
+			return nil
+		},
+		Get: func(e *Engine) string {
+			return *field(e)
+		},
+	}
+}
+
+// comboValue returns the var matching value, ignoring case.
+func comboValue(vars []string, value string) (string, error) {
+	for _, v := range vars {
+		if strings.EqualFold(value, v) {
+			return v, nil
+		}
+	}
+	return "", xerrors.Errorf("'%s' is not one of: %s", value, strings.Join(vars, ", "))
+}
+
+func lichessSpeedsOption(name, defaultValue string, field func(e *Engine) *lichess.Speeds) UCIOption {
+	return UCIOption{
+		Name:    name,
+		Type:    "string",
+		Default: defaultValue,
+		Set: func(e *Engine, value string) error {
+			speeds := strings.Split(value, ",")
+			lichessSpeeds := make(lichess.Speeds, 0, len(speeds))
+			for _, speed := range speeds {
+				// check valid enum value
+				canonical, ok := lichess.ValidSpeeds.Contains(speed)
+				if !ok {
+					return xerrors.Errorf("'%s' is not one of: %s", speed, lichess.ValidSpeeds.String())
+				}
+				// check not duplicate
+				if _, ok := lichessSpeeds.Contains(speed); ok {
+					continue
+				}
+
+				lichessSpeeds = append(lichessSpeeds, canonical)
+			}
+
+			sort.Sort(lichessSpeeds)
+
+			*field(e) = lichessSpeeds
+			return nil
+		},
+		Get: func(e *Engine) string {
+			return field(e).String()
+		},
+	}
+}
+
+func lichessRatingOption(name string, defaultValue lichess.Rating, field func(e *Engine) *lichess.Rating) UCIOption {
+	vars := make([]string, len(lichess.ValidRatings))
+	for i, rating := range lichess.ValidRatings {
+		vars[i] = rating.String()
+	}
+
+	return UCIOption{
+		Name:      name,
+		Type:      "combo",
+		Default:   defaultValue.String(),
+		ComboVars: vars,
+		Set: func(e *Engine, value string) error {
+			canonical, ok := lichess.ValidRatings.Contains(value)
+			if !ok {
+				return xerrors.Errorf("'%s' is not one of: %s", value, strings.Join(vars, ", "))
+			}
+			*field(e) = canonical
+			return nil
+		},
+		Get: func(e *Engine) string {
+			return field(e).String()
+		},
+	}
+}
+
+// lichessDateOption is a YYYY-MM month. An empty value clears it.
+func lichessDateOption(name, defaultValue string, field func(e *Engine) *lichess.Date) UCIOption {
+	return UCIOption{
+		Name:    name,
+		Type:    "string",
+		Default: defaultValue,
+		Set: func(e *Engine, value string) error {
+			if value == "" {
+				*field(e) = lichess.Date{Year: 0, Month: 0}
+				return nil
+			}
+
+			dt, err := time.Parse("2006-01", value)
+			if err != nil {
+				return xerrors.Errorf("'%s' is not a YYYY-MM date", value)
+			}
+			*field(e) = lichess.Date{Year: dt.Year(), Month: int(dt.Month())}
+			return nil
+		},
+		Get: func(e *Engine) string {
+			return field(e).String()
+		},
+	}
+}
+
+// bookFileOption loads a Polyglot book into memory when it's set. An empty value unloads it.
+func bookFileOption(name, defaultValue string) UCIOption {
+	return UCIOption{
+		Name:    name,
+		Type:    "string",
+		Default: defaultValue,
+		Set: func(e *Engine, value string) error {
+			if value == "" {
+				e.BookFile, e.book = "", nil
+				return nil
+			}
+
+			book, err := polyglot.Open(value)
+			if err != nil {
+				return err
+			}
+			e.BookFile, e.book = value, book
+			return nil
+		},
+		Get: func(e *Engine) string {
+			return e.BookFile
+		},
+	}
+}
+
+// pgnDatabaseOption loads a database written by "automock pgn ingest", or ingests a .pgn file, when it's
+// set. An empty value unloads it.
+func pgnDatabaseOption(name, defaultValue string) UCIOption {
+	return UCIOption{
+		Name:    name,
+		Type:    "string",
+		Default: defaultValue,
+		Set: func(e *Engine, value string) error {
+			if value == "" {
+				e.PGNDatabase, e.pgnDB = "", nil
+				return nil
+			}
+
+			db, err := pgndb.Open(value)
+			if err != nil {
+				return err
+			}
+			e.PGNDatabase, e.pgnDB = value, db
+			return nil
+		},
+		Get: func(e *Engine) string {
+			return e.PGNDatabase
+		},
+	}
+}
+
+// offlineOption stops AutoMock using the network. Lookups are answered from the cache and the store, and
+// the sources that aren't cached are skipped.
+func offlineOption(name string, defaultValue bool) UCIOption {
+	uciOption := checkOption(name, defaultValue, func(e *Engine) *bool { return &e.Offline })
+	set := uciOption.Set
+	uciOption.Set = func(e *Engine, value string) error {
+		if err := set(e, value); err != nil {
+			return err
+		}
+		httpcache.SetOffline(e.Offline)
+		return nil
+	}
+	return uciOption
+}
+
+// moveSourcesOption is the pipeline of move sources, e.g. "book>explorer:80,engine:20>random". See
+// movePipeline.
+func moveSourcesOption(name, defaultValue string) UCIOption {
+	return UCIOption{
+		Name:    name,
+		Type:    "string",
+		Default: defaultValue,
+		Set: func(e *Engine, value string) error {
+			pipeline, err := parseMovePipeline(value)
+			if err != nil {
+				return err
+			}
+			e.MoveSources, e.movePipeline = pipeline.String(), pipeline
+			return nil
+		},
+		Get: func(e *Engine) string {
+			return e.MoveSources
+		},
+	}
+}
+
+// opponentOption is UCI_Opponent, which GUIs send before a game. An empty value clears it.
+func opponentOption(name string) UCIOption {
+	return UCIOption{
+		Name: name,
+		Type: "string",
+		Set: func(e *Engine, value string) error {
+			if value == "" {
+				e.UCIOpponent = Opponent{}
+				return nil
+			}
+
+			opponent, err := parseOpponent(value)
+			if err != nil {
+				return err
+			}
+			e.UCIOpponent = opponent
+
+			utils.Log(fmt.Sprintf("opponent: %s", opponent))
+			e.logRatingBands()
+			return nil
+		},
+		Get: func(e *Engine) string {
+			if e.UCIOpponent == (Opponent{}) {
+				return ""
+			}
+			return e.UCIOpponent.String()
+		},
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"testing"
+
+	"automock/config"
+)
+
+func TestUCIOption_Set(t *testing.T) {
+	cases := []struct {
+		name    string
+		option  string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{name: "spin", option: "Hash", value: "64", want: "64"},
+		{name: "spin below min", option: "Hash", value: "0", want: "16", wantErr: true},
+		{name: "spin not an int", option: "Hash", value: "lots", want: "16", wantErr: true},
+		{name: "combo canonical case", option: "Move_Selection", value: "TOP_N", want: SelectionTopN},
+		{name: "combo unknown var", option: "Move_Selection", value: "best", want: SelectionProportional, wantErr: true},
+		{name: "speeds sorted and deduplicated", option: "Lichess_Speeds", value: "rapid,blitz,Blitz", want: "blitz,rapid"},
+		{name: "speeds unknown", option: "Lichess_Speeds", value: "blitz,slow", want: "ultraBullet,bullet,blitz,rapid,classical,correspondence", wantErr: true},
+		{name: "rating", option: "Lichess_Rating_Min", value: "2000", want: "2000"},
+		{name: "rating not a bucket", option: "Lichess_Rating_Min", value: "1700", want: "1600", wantErr: true},
+		{name: "date", option: "Lichess_Until", value: "2023-04", want: "2023-04"},
+		{name: "date cleared", option: "Lichess_Since", value: "", want: ""},
+		{name: "date invalid", option: "Lichess_Since", value: "2023-13", want: "2012-12", wantErr: true},
+		{name: "string", option: "Log_File", value: "/tmp/automock.log", want: "/tmp/automock.log"},
+		{name: "check", option: "Offline", value: "False", want: "false"},
+		{name: "check invalid", option: "Offline", value: "yes", want: "false", wantErr: true},
+		{name: "blunder threshold", option: "Blunder_Threshold_CP", value: "150", want: "150"},
+		{name: "opponent", option: "UCI_Opponent", value: "none  2100 HUMAN  some  one", want: "none 2100 human some one"},
+		{name: "opponent invalid", option: "UCI_Opponent", value: "GM", want: "", wantErr: true},
+		{name: "book missing", option: "Book_File", value: "testdata/missing.bin", want: "", wantErr: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// arrange
+			e := NewEngine(config.Config{})
+			uciOption, ok := e.findUCIOption(c.option)
+			if !ok {
+				t.Fatalf("option %s not found", c.option)
+			}
+
+			// act
+			err := uciOption.Set(e, c.value)
+
+			// assert
+			if (err != nil) != c.wantErr {
+				t.Errorf("wantErr: %v got: %v", c.wantErr, err)
+			}
+			if got := uciOption.Get(e); c.want != got {
+				t.Errorf("want: %q got: %q", c.want, got)
+			}
+		})
+	}
+}
+
+func TestUCIOption_String(t *testing.T) {
+	cases := []struct {
+		option string
+		want   string
+	}{
+		{option: "Hash", want: "option name Hash type spin default 16 min 1 max 33554432"},
+		{option: "Offline", want: "option name Offline type check default false"},
+		{option: "Lichess_Database", want: "option name Lichess_Database type combo default lichess var lichess var masters var blend var pgn"},
+		{option: "Book_File", want: "option name Book_File type string default <empty>"},
+		{option: "PGN_Database", want: "option name PGN_Database type string default <empty>"},
+		{option: "Lichess_Player", want: "option name Lichess_Player type string default <empty>"},
+		{option: "UCI_Opponent", want: "option name UCI_Opponent type string default <empty>"},
+		{option: "ExternalEngine_Path", want: "option name ExternalEngine_Path type string default <empty>"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.option, func(t *testing.T) {
+			// arrange
+			e := NewEngine(config.Config{})
+			uciOption, ok := e.findUCIOption(c.option)
+			if !ok {
+				t.Fatalf("option %s not found", c.option)
+			}
+
+			// act
+			got := uciOption.String()
+
+			// assert
+			if c.want != got {
+				t.Errorf("want: %q got: %q", c.want, got)
+			}
+		})
+	}
+}
@@ -4,26 +4,57 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"sync"
 	"time"
-)
 
-// TODO: remove hard coded paths
-const logFileName = "/home/jud/projects/automock/automock.log"
+	"golang.org/x/xerrors"
+)
 
-var logFile *os.File
+var (
+	logFile     *os.File
+	logFileName string
+	logMtx      sync.RWMutex
+)
 
-func init() {
-	var err error
-	logFile, err = os.OpenFile(logFileName, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+// SetLogFile opens fileName for appending and closes the previous log file. Until it's called, Log
+// discards its input.
+func SetLogFile(fileName string) error {
+	f, err := os.OpenFile(fileName, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
 	if err != nil {
-		panic(err)
+		return xerrors.Errorf("failed to open log file '%s': %w", fileName, err)
 	}
-	Log("UCI Engine Started")
+
+	logMtx.Lock()
+	prev := logFile
+	logFile = f
+	logFileName = fileName
+	logMtx.Unlock()
+
+	if prev != nil {
+		prev.Close()
+	}
+
+	return nil
+}
+
+// LogFileName returns the name of the file Log is writing to.
+func LogFileName() string {
+	logMtx.RLock()
+	defer logMtx.RUnlock()
+
+	return logFileName
 }
 
 func Log(line string) {
 	if !strings.HasSuffix(line, "\n") {
 		line += "\n"
 	}
+
+	logMtx.RLock()
+	defer logMtx.RUnlock()
+
+	if logFile == nil {
+		return
+	}
 	logFile.WriteString(fmt.Sprintf("[%s] %s", time.Now().Format("2006 "+time.StampMilli), line))
 }